@@ -4,12 +4,11 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"reflect"
 	"strconv"
 	"time"
-	"unsafe"
 
 	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/graphql/gqlerrors"
 )
@@ -17,6 +16,14 @@ import (
 // Server implements graphql http handler with websocket support (if upgrader is provided with WithUpgrader)
 type Server interface {
 	http.Handler
+
+	// SetSchema atomically replaces schema used by subsequent operations with provided one, executed by graphql-go.
+	// Operations in flight, including subscriptions, keep using schema they were parsed with, unless
+	// WithSchemaRevalidation is enabled.
+	SetSchema(schema graphql.Schema)
+
+	// SetExecutor atomically replaces Executor used by subsequent operations, same as SetSchema
+	SetExecutor(executor Executor)
 }
 
 // NewServer returns new Server instance
@@ -26,7 +33,9 @@ func NewServer(
 ) (Server, error) {
 	var c serverConfig
 
+	c.eventTimeout = DefaultEventDrivenTimeout
 	c.subscriptionProtocols = make(map[apollows.Protocol]struct{})
+	c.codecs = make(map[string]apollows.Codec)
 
 	for _, o := range options {
 		err := o(&c)
@@ -46,18 +55,40 @@ func NewServer(
 		c.resultProcessor = identityResultProcessor
 	}
 
-	f := reflect.ValueOf(&schema).Elem().FieldByName("extensions")
+	if c.errorPresenter == nil {
+		c.errorPresenter = defaultErrorPresenter
+	}
 
-	exts, ok := reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Interface().([]graphql.Extension)
-	if !ok {
-		return nil, errReflectExtensions
+	if c.panicHandler == nil {
+		c.panicHandler = defaultPanicHandler
 	}
 
-	return &serverImpl{
-		schema:       schema,
-		extensions:   exts,
+	if c.jsonCodec == nil {
+		c.jsonCodec = apollows.StdJSONCodec{}
+	}
+
+	server := &serverImpl{
+		extensions:   append([]graphql.Extension(nil), c.extraExtensions...),
 		serverConfig: c,
-	}, nil
+	}
+
+	if c.schemaRevalidation {
+		server.subscriptions = &schemaSubscriptions{
+			operations: make(map[mutable.Context]*apollows.PayloadOperation),
+		}
+	}
+
+	if c.executor != nil {
+		server.storeSchemaState(schema, c.executor)
+	} else {
+		server.SetSchema(schema)
+	}
+
+	if c.sharedSubscriptions && c.schemaResolver == nil && c.rootObjectProvider == nil {
+		server.shared = newSharedSubscriptions()
+	}
+
+	return server, nil
 }
 
 // ServerOption to configure Server
@@ -132,6 +163,83 @@ func WithKeepalive(interval time.Duration) ServerOption {
 	}
 }
 
+// WithEventDriven option enables event-driven handling of websocket connections implementing PollingConn: instead of
+// keeping dedicated reader and writer goroutines per connection, messages are read once the connection becomes
+// readable and written directly by goroutines producing them, so idle connections hold no goroutines.
+// HTTPRequest interceptor returns once such connection is set up, while request context remains active until the
+// connection is closed. Other interceptors are unaffected. Connections not implementing PollingConn are handled as
+// usual.
+// Reading a message and writing each message are bounded by DefaultEventDrivenTimeout, see WithEventDrivenTimeout.
+func WithEventDriven() ServerOption {
+	return func(config *serverConfig) error {
+		config.eventDriven = true
+
+		return nil
+	}
+}
+
+// DefaultEventDrivenTimeout is default timeout of reading and writing messages of event-driven connections
+const DefaultEventDrivenTimeout = time.Second * 10
+
+// WithEventDrivenTimeout option sets timeout of reading a message once event-driven connection is readable, and of
+// writing each message to it, so that slow client is disconnected instead of blocking goroutines serving it.
+// Zero or negative timeout disables deadlines.
+func WithEventDrivenTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) error {
+		config.eventTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithSharedSubscriptions option enables sharing of execution between identical websocket subscriptions, having the
+// same query, operation name and variables. Shared execution is started in context of the first subscriber, running
+// OperationExecute interceptors once, and stops once last subscriber leaves; each result is processed and encoded
+// once, and written as pre-encoded frame to every subscriber. Subscribers joining later receive only subsequent
+// events, subscriptions resumed with last event ID are executed separately. Subscribers not keeping up with
+// results are completed with an error.
+// Should only be used if subscription results do not depend on the connection or operation context; sharing is
+// disabled if WithSchemaResolver or WithRootObjectProvider is used.
+func WithSharedSubscriptions() ServerOption {
+	return func(config *serverConfig) error {
+		config.sharedSubscriptions = true
+
+		return nil
+	}
+}
+
+// SchemaResolver selects schema and root object for the connection or HTTP request, once Init interceptors succeed.
+// Provided context carries request mutable context (RequestContext) and HTTP request (ContextHTTPRequest), init is nil
+// for HTTP requests. Returned error is handled same as one returned by Init interceptors. Operations started before
+// connection initialization, as allowed by graphql-ws, use the default schema.
+type SchemaResolver func(
+	ctx context.Context,
+	init apollows.PayloadInit,
+) (schema graphql.Schema, rootObject map[string]interface{}, err error)
+
+// WithSchemaResolver option sets SchemaResolver, selecting schema and root object per connection instead of ones
+// provided to NewServer and WithRootObject, e.g. for multi-tenant setups. Selected schema is executed by graphql-go,
+// and is not affected by Server.SetSchema, Server.SetExecutor and WithSchemaRevalidation. Disables
+// WithSharedSubscriptions.
+func WithSchemaResolver(resolver SchemaResolver) ServerOption {
+	return func(config *serverConfig) error {
+		config.schemaResolver = resolver
+
+		return nil
+	}
+}
+
+// WithSchemaRevalidation option enables revalidation of active subscriptions once schema is replaced with
+// Server.SetSchema or Server.SetExecutor: subscriptions whose documents are no longer valid against new schema are
+// completed, others keep executing with schema they were started with.
+func WithSchemaRevalidation() ServerOption {
+	return func(config *serverConfig) error {
+		config.schemaRevalidation = true
+
+		return nil
+	}
+}
+
 // WithoutHTTPQueries option prevents HTTP queries from being handled, allowing only websocket queries
 func WithoutHTTPQueries() ServerOption {
 	return func(config *serverConfig) error {
@@ -150,6 +258,51 @@ func WithProtocol(protocol apollows.Protocol) ServerOption {
 	}
 }
 
+// WithCodec option adds subprotocol variants using provided codec for each configured protocol, e.g.
+// graphql-transport-ws+msgpack. Variants are negotiated by upgrader and require connection implementing FrameConn.
+// May be specified multiple times.
+func WithCodec(codec apollows.Codec) ServerOption {
+	return func(config *serverConfig) error {
+		config.codecs[codec.Name()] = codec
+
+		return nil
+	}
+}
+
+// WithExtensions option adds graphql extensions, receiving full lifecycle: Init, ParseDidStart, ValidationDidStart,
+// ExecutionDidStart and ResolveFieldDidStart, with GetResult merged into result extensions.
+// Extensions provided in graphql.SchemaConfig receive execution hooks only, Init, ParseDidStart and
+// ValidationDidStart hooks are received by extensions provided with this option. May be specified multiple times.
+func WithExtensions(extensions ...graphql.Extension) ServerOption {
+	return func(config *serverConfig) error {
+		config.extraExtensions = append(config.extraExtensions, extensions...)
+
+		return nil
+	}
+}
+
+// WithExecutor option sets Executor used to validate and execute operations instead of graphql-go with the schema
+// provided to NewServer, which is then only passed to extensions. Extensions receive execution hooks only from
+// executors supporting them.
+func WithExecutor(executor Executor) ServerOption {
+	return func(config *serverConfig) error {
+		config.executor = executor
+
+		return nil
+	}
+}
+
+// WithJSONCodec option sets JSON implementation used for HTTP requests and responses and websocket messages of the
+// server. Websocket messages are encoded by the server for connections implementing FrameConn, others use their own
+// ReadJSON/WriteJSON, with codec available to Upgrader via ContextJSONCodec.
+func WithJSONCodec(codec apollows.JSONCodec) ServerOption {
+	return func(config *serverConfig) error {
+		config.jsonCodec = codec
+
+		return nil
+	}
+}
+
 // WithConnectTimeout option sets duration within which client is allowed to initialize the connection before being
 // disconnected
 func WithConnectTimeout(timeout time.Duration) ServerOption {
@@ -169,6 +322,37 @@ func WithRootObject(rootObject map[string]interface{}) ServerOption {
 	}
 }
 
+// RootObjectProvider builds root object for the operation, e.g. from authentication values of the connection context
+type RootObjectProvider func(ctx context.Context, payload *apollows.PayloadOperation) map[string]interface{}
+
+// WithRootObjectProvider option sets RootObjectProvider, called for each operation before it is parsed. Root object
+// provided with WithRootObject or selected by SchemaResolver is used if provider returns nil. Disables
+// WithSharedSubscriptions.
+func WithRootObjectProvider(provider RootObjectProvider) ServerOption {
+	return func(config *serverConfig) error {
+		config.rootObjectProvider = provider
+
+		return nil
+	}
+}
+
+// VariablesCoercer returns variables to execute the operation with, allowing to decode or validate them before
+// operation is parsed, e.g. for custom scalars or opaque IDs
+type VariablesCoercer func(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+) (variables map[string]interface{}, err error)
+
+// WithVariablesCoercer option sets VariablesCoercer, called for each websocket and HTTP operation. Returned error
+// is reported as operation error.
+func WithVariablesCoercer(coercer VariablesCoercer) ServerOption {
+	return func(config *serverConfig) error {
+		config.variablesCoercer = coercer
+
+		return nil
+	}
+}
+
 // ResultProcessor allows to post-process resolved values
 type ResultProcessor func(
 	ctx context.Context,
@@ -185,6 +369,26 @@ func WithResultProcessor(proc ResultProcessor) ServerOption {
 	}
 }
 
+// WithErrorPresenter provides ErrorPresenter formatting errors sent to clients, in results, websocket error messages
+// and HTTP error responses. See NewMaskingErrorPresenter.
+func WithErrorPresenter(presenter ErrorPresenter) ServerOption {
+	return func(config *serverConfig) error {
+		config.errorPresenter = presenter
+
+		return nil
+	}
+}
+
+// WithPanicHandler provides PanicHandler called with panics recovered during operation handling, by default panics
+// are logged with standard logger together with their stack
+func WithPanicHandler(handler PanicHandler) ServerOption {
+	return func(config *serverConfig) error {
+		config.panicHandler = handler
+
+		return nil
+	}
+}
+
 // WriteError helper function writing an error to http.ResponseWriter
 func WriteError(ctx context.Context, w http.ResponseWriter, err error) {
 	if err == nil || ContextHTTPResponseStarted(ctx) {
@@ -193,20 +397,32 @@ func WriteError(ctx context.Context, w http.ResponseWriter, err error) {
 
 	var res ResultError
 
-	if !errors.As(err, &res) {
+	if errors.As(err, &res) && res.Result != nil {
+		result := *res.Result
+
+		result.Errors = presentErrors(ctx, result.Errors)
+
+		err = ResultError{
+			Result: &result,
+			json:   ContextJSONCodec(ctx),
+		}
+	} else {
 		err = ResultError{
 			Result: &graphql.Result{
 				Errors: []gqlerrors.FormattedError{
-					gqlerrors.FormatError(err),
+					presentError(ctx, err),
 				},
 			},
+			json: ContextJSONCodec(ctx),
 		}
 	}
 
+	res, _ = err.(ResultError)
+
 	bs := []byte(err.Error())
 
 	w.Header().Set("content-length", strconv.Itoa(len(bs)))
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(errorsHTTPStatus(res.Errors))
 
 	_, _ = w.Write(bs)
 }
@@ -3,14 +3,19 @@ package wsgraphql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/eientei/wsgraphql/v1/apollows"
 	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/graphql/gqlerrors"
 	"github.com/stretchr/testify/assert"
@@ -527,6 +532,100 @@ func TestWithoutHTTPQueries(t *testing.T) {
 	assert.Equal(t, true, c.rejectHTTPQueries)
 }
 
+type testJSONCodec struct {
+	apollows.StdJSONCodec
+	marshals   *int64
+	unmarshals *int64
+	results    *int64
+}
+
+func (codec testJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt64(codec.marshals, 1)
+
+	if _, ok := v.(*graphql.Result); ok {
+		atomic.AddInt64(codec.results, 1)
+	}
+
+	return codec.StdJSONCodec.Marshal(v)
+}
+
+func (codec testJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt64(codec.unmarshals, 1)
+
+	return codec.StdJSONCodec.Unmarshal(data, v)
+}
+
+func TestWithJSONCodec(t *testing.T) {
+	var marshals, unmarshals, results int64
+
+	codec := testJSONCodec{
+		marshals:   &marshals,
+		unmarshals: &unmarshals,
+		results:    &results,
+	}
+
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithJSONCodec(codec))
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+
+	assert.Greater(t, atomic.LoadInt64(&marshals), int64(0))
+	assert.Greater(t, atomic.LoadInt64(&unmarshals), int64(0))
+
+	// result payloads are encoded with the codec, not only message frames
+	assert.Greater(t, atomic.LoadInt64(&results), int64(0))
+
+	atomic.StoreInt64(&marshals, 0)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", strings.NewReader(`{"query":"query { getFoo }"}`))
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Greater(t, atomic.LoadInt64(&marshals), int64(0))
+
+	atomic.StoreInt64(&marshals, 0)
+
+	err = ResultError{Result: &graphql.Result{}, json: codec}
+
+	assert.Equal(t, `{"data":null}`, err.Error())
+	assert.EqualValues(t, 1, atomic.LoadInt64(&marshals))
+}
+
+type testExecutor struct {
+	Executor
+	validates int64
+	executes  int64
+}
+
+func (executor *testExecutor) Validate(ctx context.Context, params *ExecuteParams) []gqlerrors.FormattedError {
+	atomic.AddInt64(&executor.validates, 1)
+
+	return executor.Executor.Validate(ctx, params)
+}
+
+func (executor *testExecutor) Execute(ctx context.Context, params *ExecuteParams) (chan *graphql.Result, error) {
+	atomic.AddInt64(&executor.executes, 1)
+
+	return executor.Executor.Execute(ctx, params)
+}
+
+func TestWithExecutor(t *testing.T) {
+	executor := &testExecutor{
+		Executor: NewSchemaExecutor(testNewSchema(t)),
+	}
+
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithExecutor(executor))
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+
+	assert.Greater(t, atomic.LoadInt64(&executor.validates), int64(0))
+	assert.Greater(t, atomic.LoadInt64(&executor.executes), int64(0))
+}
+
 func TestWithRootObject(t *testing.T) {
 	var c serverConfig
 
@@ -537,6 +636,117 @@ func TestWithRootObject(t *testing.T) {
 	assert.Equal(t, obj, c.rootObject)
 }
 
+func testRootSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						root, _ := p.Info.RootValue.(map[string]interface{})
+
+						return root["user"], nil
+					},
+				},
+				"echo": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{
+						"value": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Args["value"], nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func testRootQuery(t *testing.T, srv *httptest.Server, user, body string) string {
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("x-user", user)
+
+	resp, err := srv.Client().Do(req)
+
+	assert.NoError(t, err)
+
+	bs, err := io.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	return string(bs)
+}
+
+func TestWithRootObjectProvider(t *testing.T) {
+	server, err := NewServer(
+		testRootSchema(t),
+		WithRootObject(map[string]interface{}{
+			"user": "static",
+		}),
+		WithRootObjectProvider(func(ctx context.Context, payload *apollows.PayloadOperation) map[string]interface{} {
+			user := ContextHTTPRequest(ctx).Header.Get("x-user")
+			if user == "" {
+				return nil
+			}
+
+			return map[string]interface{}{
+				"user": user,
+			}
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	assert.Contains(t, testRootQuery(t, srv, "foo", `{"query":"query { user }"}`), `"user":"foo"`)
+	assert.Contains(t, testRootQuery(t, srv, "bar", `{"query":"query { user }"}`), `"user":"bar"`)
+	assert.Contains(t, testRootQuery(t, srv, "", `{"query":"query { user }"}`), `"user":"static"`)
+}
+
+func TestWithVariablesCoercer(t *testing.T) {
+	server, err := NewServer(
+		testRootSchema(t),
+		WithVariablesCoercer(func(
+			ctx context.Context,
+			payload *apollows.PayloadOperation,
+		) (map[string]interface{}, error) {
+			value, _ := payload.Variables["value"].(string)
+			if value == "bad" {
+				return nil, errors.New("bad value")
+			}
+
+			return map[string]interface{}{
+				"value": strings.ToUpper(value),
+			}, nil
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	query := `{"query":"query ($value: String) { echo(value: $value) }","variables":{"value":"%s"}}`
+
+	assert.Contains(t, testRootQuery(t, srv, "", strings.Replace(query, "%s", "foo", 1)), `"echo":"FOO"`)
+	assert.Contains(t, testRootQuery(t, srv, "", strings.Replace(query, "%s", "bad", 1)), `bad value`)
+}
+
 func TestWriteError(t *testing.T) {
 	mutctx := mutable.NewMutableContext(context.Background())
 
@@ -587,3 +797,187 @@ func TestOptError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, srv)
 }
+
+func TestWithErrorPresenter(t *testing.T) {
+	errAllowed := errors.New("not found")
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"fail": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{
+						"allowed": &graphql.ArgumentConfig{
+							Type: graphql.Boolean,
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						if allowed, _ := p.Args["allowed"].(bool); allowed {
+							return nil, fmt.Errorf("user: %w", errAllowed)
+						}
+
+						return nil, errors.New("connection to db refused")
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	var (
+		reported []string
+		m        sync.Mutex
+	)
+
+	server, err := NewServer(
+		schema,
+		WithErrorPresenter(NewMaskingErrorPresenter(func(ctx context.Context, id string, err error) {
+			m.Lock()
+			defer m.Unlock()
+
+			reported = append(reported, id+": "+err.Error())
+		}, errAllowed)),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	res := testRootQuery(t, srv, "", `{"query":"{ fail }"}`)
+
+	assert.Contains(t, res, MaskedErrorMessage)
+	assert.Contains(t, res, `"path":["fail"]`)
+	assert.NotContains(t, res, "refused")
+	assert.Contains(t, res, `"`+ExtensionCode+`":"INTERNAL_SERVER_ERROR"`)
+
+	m.Lock()
+
+	if assert.Len(t, reported, 1) {
+		id := strings.Split(reported[0], ": ")[0]
+
+		assert.Contains(t, res, `"`+ExtensionCorrelationID+`":"`+id+`"`)
+		assert.Contains(t, reported[0], "connection to db refused")
+	}
+
+	m.Unlock()
+
+	assert.Contains(t, testRootQuery(t, srv, "", `{"query":"{ fail(allowed: true) }"}`), "user: not found")
+	assert.Contains(t, testRootQuery(t, srv, "", `{"query":"{ unknown }"}`), `Cannot query field \"unknown\"`)
+	assert.Contains(t, testRootQuery(t, srv, "", `{"query":"{"}`), "Syntax Error")
+}
+
+func TestWithPanicHandler(t *testing.T) {
+	var (
+		recovered []*PanicError
+		m         sync.Mutex
+	)
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithVariablesCoercer(func(ctx context.Context, payload *apollows.PayloadOperation) (map[string]interface{}, error) {
+			if payload.Variables["panic"] == "parse" {
+				panic("parse panic")
+			}
+
+			return payload.Variables, nil
+		}),
+		WithResultProcessor(func(
+			ctx context.Context,
+			payload *apollows.PayloadOperation,
+			result *graphql.Result,
+		) *graphql.Result {
+			if payload.Variables["panic"] == "result" {
+				panic(errors.New("result panic"))
+			}
+
+			return result
+		}),
+		WithPanicHandler(func(ctx context.Context, err *PanicError) error {
+			m.Lock()
+			defer m.Unlock()
+
+			recovered = append(recovered, err)
+
+			return fmt.Errorf("recovered: %v", err.Value)
+		}),
+	)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	for _, id := range []string{"parse", "result", "ok"} {
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `query { getFoo }`,
+					Variables: map[string]interface{}{
+						"panic": id,
+					},
+				},
+			},
+		}))
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, id, msg.ID)
+
+		switch id {
+		case "parse":
+			assert.Equal(t, apollows.OperationError, msg.Type)
+			assert.Contains(t, string(msg.Payload.RawMessage), "recovered: parse panic")
+		case "result":
+			assert.Equal(t, apollows.OperationNext, msg.Type)
+			assert.Contains(t, string(msg.Payload.RawMessage), "recovered: result panic")
+
+			assert.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, apollows.OperationComplete, msg.Type)
+		default:
+			assert.Equal(t, apollows.OperationNext, msg.Type)
+
+			pd, err := msg.Payload.ReadPayloadData()
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+			assert.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, apollows.OperationComplete, msg.Type)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if assert.Len(t, recovered, 2) {
+		assert.Equal(t, "panic: parse panic", recovered[0].Error())
+		assert.Contains(t, string(recovered[0].Stack), "operationParse")
+		assert.EqualError(t, recovered[1].Unwrap(), "result panic")
+		assert.Contains(t, string(recovered[1].Stack), "processResult")
+	}
+}
@@ -0,0 +1,36 @@
+package apollows
+
+import "strings"
+
+// CodecSeparator separates protocol name from codec name in subprotocol variant, e.g. graphql-transport-ws+msgpack
+const CodecSeparator = "+"
+
+// Codec encodes and decodes protocol messages exchanged over subprotocol variant
+type Codec interface {
+	// Name returns codec name used as subprotocol variant suffix
+	Name() string
+
+	// Binary returns true if encoded messages are to be sent as binary frames
+	Binary() bool
+
+	// Marshal encodes message
+	Marshal(message *Message) ([]byte, error)
+
+	// Unmarshal decodes message, populating Payload.RawMessage with JSON representation of the payload
+	Unmarshal(data []byte, message *Message) error
+}
+
+// Variant returns subprotocol name combining the protocol with provided codec
+func (p Protocol) Variant(codec Codec) string {
+	return string(p) + CodecSeparator + codec.Name()
+}
+
+// ParseSubprotocol splits subprotocol name into protocol and codec name, which is empty for plain JSON subprotocol
+func ParseSubprotocol(subprotocol string) (protocol Protocol, codec string) {
+	idx := strings.LastIndex(subprotocol, CodecSeparator)
+	if idx < 0 {
+		return Protocol(subprotocol), ""
+	}
+
+	return Protocol(subprotocol[:idx]), subprotocol[idx+len(CodecSeparator):]
+}
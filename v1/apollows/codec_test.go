@@ -0,0 +1,19 @@
+package apollows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubprotocol(t *testing.T) {
+	protocol, codec := ParseSubprotocol("graphql-transport-ws+msgpack")
+
+	assert.Equal(t, WebsocketSubprotocolGraphqlTransportWS, protocol)
+	assert.Equal(t, "msgpack", codec)
+
+	protocol, codec = ParseSubprotocol("graphql-ws")
+
+	assert.Equal(t, WebsocketSubprotocolGraphqlWS, protocol)
+	assert.Equal(t, "", codec)
+}
@@ -0,0 +1,88 @@
+package apollows
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONMarshaler encodes values as JSON
+type JSONMarshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// JSONUnmarshaler decodes JSON into values
+type JSONUnmarshaler interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONEncoder writes JSON values to underlying stream
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+// JSONDecoder reads JSON values from underlying stream
+type JSONDecoder interface {
+	Decode(v interface{}) error
+}
+
+// JSONCodec provides JSON implementation, must be compatible with encoding/json, including support for
+// json.Marshaler and json.Unmarshaler
+type JSONCodec interface {
+	JSONMarshaler
+	JSONUnmarshaler
+
+	// NewEncoder returns encoder writing to w
+	NewEncoder(w io.Writer) JSONEncoder
+
+	// NewDecoder returns decoder reading from r
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// StdJSONCodec implements JSONCodec using encoding/json
+type StdJSONCodec struct{}
+
+// Marshal implementation
+func (StdJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implementation
+func (StdJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// NewEncoder implementation
+func (StdJSONCodec) NewEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+// NewDecoder implementation
+func (StdJSONCodec) NewDecoder(r io.Reader) JSONDecoder {
+	return json.NewDecoder(r)
+}
+
+// JSONMessageCodec implements Codec encoding messages as JSON text using provided JSONCodec, used for subprotocols
+// without codec variant
+type JSONMessageCodec struct {
+	JSON JSONCodec
+}
+
+// Name implementation
+func (JSONMessageCodec) Name() string {
+	return ""
+}
+
+// Binary implementation
+func (JSONMessageCodec) Binary() bool {
+	return false
+}
+
+// Marshal implementation
+func (codec JSONMessageCodec) Marshal(message *Message) ([]byte, error) {
+	return codec.JSON.Marshal(message)
+}
+
+// Unmarshal implementation
+func (codec JSONMessageCodec) Unmarshal(data []byte, message *Message) error {
+	return codec.JSON.Unmarshal(data, message)
+}
@@ -0,0 +1,98 @@
+// Package msgpack provides MessagePack apollows.Codec, negotiated as subprotocol variant, e.g.
+// graphql-transport-ws+msgpack
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// Name of the codec, used as subprotocol variant suffix
+const Name = "msgpack"
+
+// Codec implements apollows.Codec encoding messages as MessagePack, representing the same data model as JSON
+type Codec struct {
+	// JSON used to (de-)serialize messages before conversion, encoding/json is used if nil
+	JSON apollows.JSONCodec
+}
+
+// Name implementation
+func (Codec) Name() string {
+	return Name
+}
+
+// Binary implementation
+func (Codec) Binary() bool {
+	return true
+}
+
+// Marshal implementation
+func (codec Codec) Marshal(message *apollows.Message) ([]byte, error) {
+	bs, err := codec.json().Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromJSON(bs)
+}
+
+// Unmarshal implementation
+func (codec Codec) Unmarshal(data []byte, message *apollows.Message) error {
+	bs, err := ToJSON(data)
+	if err != nil {
+		return err
+	}
+
+	return codec.json().Unmarshal(bs, message)
+}
+
+func (codec Codec) json() apollows.JSONCodec {
+	if codec.JSON == nil {
+		return apollows.StdJSONCodec{}
+	}
+
+	return codec.JSON
+}
+
+// FromJSON converts JSON document into MessagePack
+func FromJSON(bs []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+
+	dec.UseNumber()
+
+	var v interface{}
+
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	var enc encoder
+
+	err = enc.encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.buf.Bytes(), nil
+}
+
+// ToJSON converts MessagePack document into JSON
+func ToJSON(bs []byte) ([]byte, error) {
+	dec := decoder{
+		data: bs,
+	}
+
+	v, err := dec.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.pos != len(dec.data) {
+		return nil, errTrailingData
+	}
+
+	return json.Marshal(v)
+}
@@ -0,0 +1,121 @@
+package msgpack
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundtrip(t *testing.T) {
+	for _, doc := range []string{
+		`null`,
+		`true`,
+		`false`,
+		`0`,
+		`127`,
+		`128`,
+		`-1`,
+		`-32`,
+		`-33`,
+		`-129`,
+		`65536`,
+		`-2147483649`,
+		`18446744073709551615`,
+		`1.5`,
+		`0.1`,
+		`""`,
+		`"` + strings.Repeat("a", 31) + `"`,
+		`"` + strings.Repeat("a", 32) + `"`,
+		`"` + strings.Repeat("a", 256) + `"`,
+		`"` + strings.Repeat("a", 65536) + `"`,
+		`[]`,
+		`[1,"2",[3]]`,
+		`{}`,
+		`{"a":{"b":[null,true,{"c":-1.25}]}}`,
+		`[` + strings.TrimSuffix(strings.Repeat(`1,`, 16), ",") + `]`,
+		`[` + strings.TrimSuffix(strings.Repeat(`1,`, 65536), ",") + `]`,
+	} {
+		bs, err := FromJSON([]byte(doc))
+
+		assert.NoError(t, err, doc)
+
+		res, err := ToJSON(bs)
+
+		assert.NoError(t, err, doc)
+		assert.JSONEq(t, doc, string(res))
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	bs, err := FromJSON([]byte(`{"compact":true,"schema":0}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "82a7636f6d70616374c3a6736368656d6100", hex.EncodeToString(bs))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"a5616263",
+		"dc0010",
+		"dfffffffff",
+		"8101c0",
+		"c1",
+		"c0c0",
+		"d90561",
+	} {
+		bs, err := hex.DecodeString(data)
+
+		assert.NoError(t, err)
+
+		_, err = ToJSON(bs)
+
+		assert.Error(t, err, data)
+	}
+}
+
+func TestDecodeBinary(t *testing.T) {
+	bs, err := hex.DecodeString("c403616263")
+
+	assert.NoError(t, err)
+
+	res, err := ToJSON(bs)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc"`, string(res))
+}
+
+func TestCodec(t *testing.T) {
+	var codec apollows.Codec = Codec{}
+
+	assert.Equal(t, "graphql-transport-ws+msgpack", apollows.WebsocketSubprotocolGraphqlTransportWS.Variant(codec))
+	assert.True(t, codec.Binary())
+
+	bs, err := codec.Marshal(&apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationNext,
+		Payload: apollows.Data{
+			Value: map[string]interface{}{
+				"data": map[string]interface{}{
+					"foo": 123,
+				},
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	assert.NoError(t, codec.Unmarshal(bs, &msg))
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	pd, err := msg.Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 123, pd.Data["foo"])
+}
@@ -0,0 +1,350 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// maxDepth limits nesting of decoded documents
+const maxDepth = 1000
+
+var (
+	errTruncated    = errors.New("msgpack: unexpected end of data")
+	errTrailingData = errors.New("msgpack: trailing data after document")
+	errTooDeep      = errors.New("msgpack: document nesting is too deep")
+	errMapKey       = errors.New("msgpack: map key is not a string")
+)
+
+// encoder writes JSON data model values as MessagePack
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (enc *encoder) encode(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		enc.buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			enc.buf.WriteByte(0xc3)
+		} else {
+			enc.buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		return enc.encodeNumber(v)
+	case float64:
+		enc.encodeFloat(v)
+	case string:
+		enc.encodeString(v)
+	case []interface{}:
+		enc.encodeLength(len(v), 0x90, 15, 0xdc, 0xdd)
+
+		for _, item := range v {
+			err := enc.encode(item)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		enc.encodeLength(len(v), 0x80, 15, 0xde, 0xdf)
+
+		keys := make([]string, 0, len(v))
+
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			enc.encodeString(k)
+
+			err := enc.encode(v[k])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+func (enc *encoder) encodeNumber(v json.Number) error {
+	i, err := strconv.ParseInt(string(v), 10, 64)
+	if err == nil {
+		enc.encodeInt(i)
+
+		return nil
+	}
+
+	u, err := strconv.ParseUint(string(v), 10, 64)
+	if err == nil {
+		enc.buf.WriteByte(0xcf)
+		enc.writeUint(u, 8)
+
+		return nil
+	}
+
+	f, err := v.Float64()
+	if err != nil {
+		return err
+	}
+
+	enc.encodeFloat(f)
+
+	return nil
+}
+
+func (enc *encoder) encodeInt(i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		enc.buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		enc.buf.WriteByte(byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		enc.buf.WriteByte(0xd0)
+		enc.writeUint(uint64(i), 1)
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		enc.buf.WriteByte(0xd1)
+		enc.writeUint(uint64(i), 2)
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		enc.buf.WriteByte(0xd2)
+		enc.writeUint(uint64(i), 4)
+	default:
+		enc.buf.WriteByte(0xd3)
+		enc.writeUint(uint64(i), 8)
+	}
+}
+
+func (enc *encoder) encodeFloat(f float64) {
+	if float64(float32(f)) == f {
+		enc.buf.WriteByte(0xca)
+		enc.writeUint(uint64(math.Float32bits(float32(f))), 4)
+
+		return
+	}
+
+	enc.buf.WriteByte(0xcb)
+	enc.writeUint(math.Float64bits(f), 8)
+}
+
+func (enc *encoder) encodeString(s string) {
+	if len(s) <= 31 {
+		enc.buf.WriteByte(0xa0 | byte(len(s)))
+	} else {
+		enc.encodeLength(len(s), 0, 0, 0xda, 0xdb)
+	}
+
+	enc.buf.WriteString(s)
+}
+
+// encodeLength writes container length using fixed format if it fits into fixmax, or 16/32 bit formats otherwise;
+// strings additionally use str8 format
+func (enc *encoder) encodeLength(n int, fix byte, fixmax int, f16, f32 byte) {
+	switch {
+	case n <= fixmax:
+		enc.buf.WriteByte(fix | byte(n))
+	case fix == 0 && n <= math.MaxUint8:
+		enc.buf.WriteByte(0xd9)
+		enc.writeUint(uint64(n), 1)
+	case n <= math.MaxUint16:
+		enc.buf.WriteByte(f16)
+		enc.writeUint(uint64(n), 2)
+	default:
+		enc.buf.WriteByte(f32)
+		enc.writeUint(uint64(n), 4)
+	}
+}
+
+func (enc *encoder) writeUint(u uint64, size int) {
+	var b [8]byte
+
+	binary.BigEndian.PutUint64(b[:], u)
+
+	enc.buf.Write(b[8-size:])
+}
+
+// decoder reads MessagePack into JSON data model values, binary data is represented as string
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (dec *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(dec.data)-dec.pos < n {
+		return nil, errTruncated
+	}
+
+	bs := dec.data[dec.pos : dec.pos+n]
+
+	dec.pos += n
+
+	return bs, nil
+}
+
+func (dec *decoder) readUint(size int) (uint64, error) {
+	bs, err := dec.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var b [8]byte
+
+	copy(b[8-size:], bs)
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (dec *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+
+	bs, err := dec.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bs[0]
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return dec.decodeString(int(b & 0x1f))
+	case b&0xf0 == 0x90:
+		return dec.decodeArray(int(b&0x0f), depth)
+	case b&0xf0 == 0x80:
+		return dec.decodeMap(int(b&0x0f), depth)
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return dec.readUint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		return dec.decodeInt(1 << (b - 0xd0))
+	case 0xca:
+		u, err := dec.readUint(4)
+
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := dec.readUint(8)
+
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := dec.readUint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.decodeString(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := dec.readUint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := dec.readUint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.decodeArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := dec.readUint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.decodeMap(int(n), depth)
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", b)
+}
+
+func (dec *decoder) decodeInt(size int) (interface{}, error) {
+	u, err := dec.readUint(size)
+	if err != nil {
+		return nil, err
+	}
+
+	shift := 64 - 8*size
+
+	return int64(u<<shift) >> shift, nil
+}
+
+func (dec *decoder) decodeString(n int) (interface{}, error) {
+	bs, err := dec.read(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(bs), nil
+}
+
+func (dec *decoder) decodeArray(n int, depth int) (interface{}, error) {
+	// every element takes at least one byte, guarding against allocations for bogus lengths
+	if n > len(dec.data)-dec.pos {
+		return nil, errTruncated
+	}
+
+	arr := make([]interface{}, n)
+
+	for i := range arr {
+		v, err := dec.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		arr[i] = v
+	}
+
+	return arr, nil
+}
+
+func (dec *decoder) decodeMap(n int, depth int) (interface{}, error) {
+	if n*2 > len(dec.data)-dec.pos {
+		return nil, errTruncated
+	}
+
+	m := make(map[string]interface{}, n)
+
+	for i := 0; i < n; i++ {
+		k, err := dec.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, errMapKey
+		}
+
+		v, err := dec.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		m[key] = v
+	}
+
+	return m, nil
+}
@@ -161,6 +161,9 @@ const (
 	// EventUnauthorized indicated attempt to subscribe to an operation before receiving OperationConnectionAck
 	EventUnauthorized MessageType = 4401
 
+	// EventForbidden indicates connection initialization rejected due to insufficient permissions
+	EventForbidden MessageType = 4403
+
 	// EventInitializationTimeout indicates timeout occurring before client sending OperationConnectionInit
 	EventInitializationTimeout MessageType = 4408
 
@@ -170,12 +173,17 @@ const (
 	// EventSubscriberAlreadyExists indicates subscribed operation ID already being in use
 	// (not yet terminated by either OperationComplete or OperationError)
 	EventSubscriberAlreadyExists MessageType = 4409
+
+	// EventInternalServerError indicates unexpected server failure
+	EventInternalServerError MessageType = 4500
 )
 
 var messageTypeDescriptions = map[MessageType]string{
 	EventCloseNormal:                   "Termination requested",
 	EventInvalidMessage:                "Invalid message",
 	EventUnauthorized:                  "Unauthorized",
+	EventForbidden:                     "Forbidden",
+	EventInternalServerError:           "Internal server error",
 	EventInitializationTimeout:         "Connection initialisation timeout",
 	EventTooManyInitializationRequests: "Too many initialisation requests",
 }
@@ -320,10 +328,21 @@ type PayloadError struct {
 	Path       []string               `json:"path"`
 }
 
+// PayloadIncremental client-side representation of incremental delivery entry, carrying deferred fragment data
+type PayloadIncremental struct {
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+	Label      string                 `json:"label,omitempty"`
+	Errors     []PayloadError         `json:"errors,omitempty"`
+	Path       []interface{}          `json:"path"`
+}
+
 // PayloadDataResponse provides client-side payload representation
 type PayloadDataResponse struct {
-	Data   map[string]interface{} `json:"data,omitempty"`
-	Errors []PayloadError         `json:"errors,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Errors      []PayloadError         `json:"errors,omitempty"`
+	Incremental []PayloadIncremental   `json:"incremental,omitempty"`
+	HasNext     bool                   `json:"hasNext,omitempty"`
 }
 
 // MessageRaw encapsulates every message within apollows protocol in both directions
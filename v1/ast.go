@@ -12,6 +12,35 @@ import (
 	"github.com/graphql-go/graphql/language/source"
 )
 
+// extensionsContext exposes values set by extensions during parsing and validation to execution, while keeping
+// cancellation and values of the execution context
+type extensionsContext struct {
+	context.Context
+	values context.Context
+}
+
+func (ctx extensionsContext) Value(key interface{}) interface{} {
+	v := ctx.Context.Value(key)
+	if v == nil {
+		v = ctx.values.Value(key)
+	}
+
+	return v
+}
+
+// executionContext returns context for operation execution, carrying values set by extensions
+func (server *serverImpl) executionContext(ctx context.Context) context.Context {
+	params := ContextOperationParams(ctx)
+	if len(server.extensions) == 0 || params == nil || params.Context == nil {
+		return ctx
+	}
+
+	return extensionsContext{
+		Context: ctx,
+		values:  params.Context,
+	}
+}
+
 func (server *serverImpl) handleExtensionsInits(p *graphql.Params) *graphql.Result {
 	var errs gqlerrors.FormattedErrors
 
@@ -169,7 +198,7 @@ func (server *serverImpl) parseAST(
 
 	defer func() {
 		if result != nil {
-			err = ResultError{Result: result}
+			err = server.resultError(result)
 		}
 	}()
 
@@ -178,10 +207,24 @@ func (server *serverImpl) parseAST(
 		Name: "GraphQL request",
 	})
 
+	state := server.operationSchemaState(ctx)
+
+	opctx.Set(contextKeySchemaState, state)
+
+	rootObject := state.rootObject
+
+	if server.rootObjectProvider != nil {
+		if root := server.rootObjectProvider(ctx, payload); root != nil {
+			rootObject = root
+		}
+	}
+
+	opctx.Set(contextKeyRootObject, rootObject)
+
 	params := graphql.Params{
-		Schema:         server.schema,
+		Schema:         state.schema,
 		RequestString:  payload.Query,
-		RootObject:     server.rootObject,
+		RootObject:     rootObject,
 		VariableValues: payload.Variables,
 		OperationName:  payload.OperationName,
 		Context:        ctx,
@@ -205,41 +248,77 @@ func (server *serverImpl) parseAST(
 
 	opctx.Set(ContextKeyAST, astdoc)
 
-	result = parseFinishFn(err)
+	result = parseFinishFn(withErrorCode(err, ErrorCodeGraphqlParseFailed))
 	if result != nil {
 		return
 	}
 
+	op, err := parsedOperation(astdoc, payload.OperationName)
+	if err != nil {
+		result = &graphql.Result{
+			Errors: []gqlerrors.FormattedError{
+				FormatError(err),
+			},
+		}
+
+		return
+	}
+
+	opctx.Set(ContextKeyOperationDefinition, op)
+	opctx.Set(ContextKeySubscription, op.Operation == ast.OperationTypeSubscription)
+
 	errs, validationFinishFn := server.handleExtensionsValidationDidStart(&params)
 
-	validationResult := graphql.ValidateDocument(&params.Schema, astdoc, nil)
+	validationErrors := state.executor.Validate(ctx, server.executeParams(ctx, payload))
 
-	errs = append(errs, validationFinishFn(validationResult.Errors)...)
+	errs = append(errs, validationFinishFn(withErrorCodes(validationErrors, ErrorCodeGraphqlValidationFailed))...)
 
-	if len(errs) > 0 || !validationResult.IsValid {
+	if len(errs) > 0 {
 		result = &graphql.Result{
 			Errors: errs,
 		}
-
-		return
 	}
 
-	var subscription bool
+	return
+}
 
+// selectOperation returns operation selected by name, or the only operation of the document if name is empty
+func selectOperation(astdoc *ast.Document, name string) (res *ast.OperationDefinition) {
 	for _, definition := range astdoc.Definitions {
 		op, ok := definition.(*ast.OperationDefinition)
 		if !ok {
 			continue
 		}
 
-		if op.Operation == ast.OperationTypeSubscription {
-			subscription = true
-
-			break
+		switch {
+		case name == "" && res != nil:
+			return nil
+		case name == "":
+			res = op
+		case op.Name != nil && op.Name.Value == name:
+			return op
 		}
 	}
 
-	opctx.Set(ContextKeySubscription, subscription)
+	return res
+}
 
-	return
+// parsedOperation returns operation of the document selected by name, or the only operation if name is empty
+func parsedOperation(astdoc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	op := selectOperation(astdoc, name)
+	if op != nil {
+		return op, nil
+	}
+
+	if name != "" {
+		return nil, NewBadUserInputError(fmt.Sprintf("Unknown operation named %q.", name))
+	}
+
+	for _, definition := range astdoc.Definitions {
+		if _, ok := definition.(*ast.OperationDefinition); ok {
+			return nil, NewBadUserInputError("Must provide operation name if query contains multiple operations.")
+		}
+	}
+
+	return nil, NewBadUserInputError("Must provide an operation.")
 }
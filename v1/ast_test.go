@@ -112,6 +112,84 @@ func TestASTParseSubscription(t *testing.T) {
 	assert.NotNil(t, ContextOperationParams(opctx))
 }
 
+func TestASTParseOperationSelection(t *testing.T) {
+	server, err := NewServer(testNewSchema(t))
+
+	assert.NoError(t, err)
+
+	impl, ok := server.(*serverImpl)
+
+	assert.True(t, ok)
+
+	query := `query Foo { getFoo } subscription Updates { fooUpdates }`
+
+	for _, c := range []struct {
+		name          string
+		query         string
+		operationName string
+		operationType string
+		err           string
+	}{
+		{
+			name:          "query",
+			query:         query,
+			operationName: "Foo",
+			operationType: "query",
+		},
+		{
+			name:          "subscription",
+			query:         query,
+			operationName: "Updates",
+			operationType: "subscription",
+		},
+		{
+			name:  "missing name",
+			query: query,
+			err:   "Must provide operation name if query contains multiple operations.",
+		},
+		{
+			name:          "unknown name",
+			query:         query,
+			operationName: "Bar",
+			err:           `Unknown operation named \"Bar\".`,
+		},
+		{
+			name:  "no operations",
+			query: `fragment F on QueryRoot { getFoo }`,
+			err:   "Must provide an operation.",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			opctx := mutable.NewMutableContext(context.Background())
+			opctx.Set(ContextKeyOperationContext, opctx)
+
+			err := impl.parseAST(opctx, &apollows.PayloadOperation{
+				Query:         c.query,
+				OperationName: c.operationName,
+			})
+
+			if c.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), c.err)
+					assert.Contains(t, err.Error(), string(ErrorCodeBadUserInput))
+				}
+
+				assert.Nil(t, ContextOperationDefinition(opctx))
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.operationType, ContextOperationType(opctx))
+			assert.Equal(t, c.operationType == "subscription", ContextSubscription(opctx))
+
+			if assert.NotNil(t, ContextOperationDefinition(opctx)) {
+				assert.Equal(t, c.operationName, ContextOperationDefinition(opctx).Name.Value)
+			}
+		})
+	}
+}
+
 type testExt struct {
 	initFn                 func(ctx context.Context, p *graphql.Params) context.Context
 	hasResultFn            func() bool
@@ -218,15 +296,12 @@ func testAstParseExtensions(
 				},
 			},
 		}),
-		Extensions: []graphql.Extension{
-			text,
-		},
 	})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, schema)
 
-	server, err := NewServer(schema)
+	server, err := NewServer(schema, WithExtensions(text))
 
 	assert.NoError(t, err)
 	assert.NotNil(t, server)
@@ -339,3 +414,175 @@ func TestASTParseExtensionsPanicParseCb(t *testing.T) {
 	assert.NotNil(t, ContextAST(opctx))
 	assert.NotNil(t, ContextOperationParams(opctx))
 }
+
+type testExtKey struct{}
+
+func testLifecycleExt(name string, hooks *[]string) *testExt {
+	record := func(hook string) {
+		*hooks = append(*hooks, name+"."+hook)
+	}
+
+	return &testExt{
+		name: name,
+		initFn: func(ctx context.Context, p *graphql.Params) context.Context {
+			record("Init")
+
+			return context.WithValue(ctx, testExtKey{}, name)
+		},
+		hasResultFn: func() bool {
+			return true
+		},
+		getResultFn: func(ctx context.Context) interface{} {
+			return name + "-result"
+		},
+		parseDidStartFn: func(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+			record("ParseDidStart")
+
+			return ctx, func(err error) {}
+		},
+		validationDidStartFn: func(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+			record("ValidationDidStart")
+
+			return ctx, func(errors []gqlerrors.FormattedError) {}
+		},
+		executionDidStartFn: func(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+			v, _ := ctx.Value(testExtKey{}).(string)
+
+			record("ExecutionDidStart:" + v)
+
+			return ctx, func(result *graphql.Result) {}
+		},
+		resolveFieldDidStartFn: func(
+			ctx context.Context,
+			i *graphql.ResolveInfo,
+		) (context.Context, graphql.ResolveFieldFinishFunc) {
+			record("ResolveFieldDidStart:" + i.FieldName)
+
+			return ctx, func(i interface{}, err error) {}
+		},
+	}
+}
+
+func TestWithExtensionsLifecycle(t *testing.T) {
+	var hooks []string
+
+	configured := testLifecycleExt("configured", &hooks)
+	explicit := testLifecycleExt("explicit", &hooks)
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Extensions: []graphql.Extension{
+			configured,
+		},
+	})
+
+	assert.NoError(t, err)
+
+	server, err := NewServer(schema, WithExtensions(explicit))
+
+	assert.NoError(t, err)
+
+	impl := server.(*serverImpl)
+
+	opctx := mutable.NewMutableContext(context.Background())
+	opctx.Set(ContextKeyOperationContext, opctx)
+
+	payload := &apollows.PayloadOperation{
+		Query: `query { foo }`,
+	}
+
+	assert.NoError(t, impl.operationParse(opctx, payload))
+
+	cres, err := impl.operationExecute(opctx, payload)
+
+	assert.NoError(t, err)
+
+	result := <-cres
+
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{
+		"configured": "configured-result",
+		"explicit":   "explicit-result",
+	}, result.Extensions)
+
+	// extensions provided with graphql.SchemaConfig receive execution hooks only, preceding ones provided with
+	// WithExtensions
+	assert.Equal(t, []string{
+		"explicit.Init",
+		"explicit.ParseDidStart",
+		"explicit.ValidationDidStart",
+		"configured.ExecutionDidStart:explicit",
+		"explicit.ExecutionDidStart:explicit",
+		"configured.ResolveFieldDidStart:foo",
+		"explicit.ResolveFieldDidStart:foo",
+	}, hooks)
+}
+
+func TestWithExtensionsSharedSchema(t *testing.T) {
+	var hooks []string
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Extensions: []graphql.Extension{
+			testLifecycleExt("configured", &hooks),
+		},
+	})
+
+	assert.NoError(t, err)
+
+	first, err := NewServer(schema, WithExtensions(testLifecycleExt("first", &hooks)))
+
+	assert.NoError(t, err)
+
+	// second server must not overwrite extensions added to the schema of the first one
+	second, err := NewServer(schema, WithExtensions(testLifecycleExt("second", &hooks)))
+
+	assert.NoError(t, err)
+
+	// schema replaced later receives extensions of the server as well
+	second.SetSchema(schema)
+
+	for name, server := range map[string]Server{"first": first, "second": second} {
+		opctx := mutable.NewMutableContext(context.Background())
+		opctx.Set(ContextKeyOperationContext, opctx)
+
+		payload := &apollows.PayloadOperation{
+			Query: `query { foo }`,
+		}
+
+		impl := server.(*serverImpl)
+
+		assert.NoError(t, impl.operationParse(opctx, payload))
+
+		cres, err := impl.operationExecute(opctx, payload)
+
+		assert.NoError(t, err)
+
+		result := <-cres
+
+		assert.Equal(t, map[string]interface{}{
+			"configured": "configured-result",
+			name:         name + "-result",
+		}, result.Extensions)
+	}
+}
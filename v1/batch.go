@@ -0,0 +1,187 @@
+package wsgraphql
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+var (
+	errBatchRejected     = errors.New("query batching is not enabled")
+	errBatchTooLarge     = errors.New("query batch is too large")
+	errBatchSubscription = errors.New("subscriptions are not supported in query batch")
+)
+
+// WithBatching option enables HTTP query batching, allowing JSON array of operations to be sent in a single request,
+// with up to maxSize operations (unlimited if 0) executed with up to parallelism operations at once (unlimited if 0).
+// Results are returned as JSON array in the same order.
+func WithBatching(maxSize, parallelism int) ServerOption {
+	return func(config *serverConfig) error {
+		config.batching = true
+		config.batchMaxSize = maxSize
+		config.batchParallelism = parallelism
+
+		return nil
+	}
+}
+
+// isJSONArray returns true if first non-whitespace byte in the reader starts JSON array
+func isJSONArray(r *bufio.Reader) bool {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return false
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.ReadByte()
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (server *serverImpl) serveBatchRequest(
+	reqctx context.Context,
+	body *bufio.Reader,
+	uploads *uploadForm,
+) (err error) {
+	if !server.batching {
+		return errBatchRejected
+	}
+
+	var payloads []*apollows.PayloadOperation
+
+	err = server.jsonCodec.NewDecoder(body).Decode(&payloads)
+	if err != nil {
+		return
+	}
+
+	if server.batchMaxSize > 0 && len(payloads) > server.batchMaxSize {
+		return errBatchTooLarge
+	}
+
+	for i, payload := range payloads {
+		if payload == nil {
+			payload = &apollows.PayloadOperation{}
+			payloads[i] = payload
+		}
+
+		err = uploads.inject(payload, strconv.Itoa(i))
+		if err != nil {
+			return
+		}
+	}
+
+	parallelism := server.batchParallelism
+	if parallelism <= 0 || parallelism > len(payloads) {
+		parallelism = len(payloads)
+	}
+
+	results := make([]interface{}, len(payloads))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+
+	for i, payload := range payloads {
+		sem <- struct{}{}
+
+		wg.Add(1)
+
+		go func(idx int, payload *apollows.PayloadOperation) {
+			defer func() {
+				<-sem
+
+				wg.Done()
+			}()
+
+			results[idx] = server.batchOperation(reqctx, idx, payload)
+		}(i, payload)
+	}
+
+	wg.Wait()
+
+	bs, err := server.jsonCodec.Marshal(results)
+	if err != nil {
+		return
+	}
+
+	w := ContextHTTPResponseWriter(reqctx)
+
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("content-length", strconv.Itoa(len(bs)))
+
+	_, err = w.Write(bs)
+
+	RequestContext(reqctx).Set(ContextKeyHTTPResponseStarted, true)
+
+	return
+}
+
+func (server *serverImpl) batchOperation(
+	reqctx context.Context,
+	idx int,
+	payload *apollows.PayloadOperation,
+) (res interface{}) {
+	opctx := mutable.NewMutableContext(reqctx)
+	opctx.Set(ContextKeyOperationContext, opctx)
+	opctx.Set(ContextKeyBatchIndex, idx)
+
+	defer opctx.Cancel()
+
+	err := server.serveOperation(opctx, payload, server.batchRequestOperation(&res))
+
+	if res != nil || err == nil {
+		return res
+	}
+
+	var reserr ResultError
+
+	if errors.As(err, &reserr) && reserr.Result != nil {
+		result := *reserr.Result
+
+		result.Errors = presentErrors(opctx, result.Errors)
+
+		return &result
+	}
+
+	return &graphql.Result{
+		Errors: []gqlerrors.FormattedError{
+			presentError(opctx, err),
+		},
+	}
+}
+
+func (server *serverImpl) batchRequestOperation(res *interface{}) HandlerOperation {
+	return func(ctx context.Context, payload *apollows.PayloadOperation) error {
+		err := server.interceptors.OperationParse(ctx, payload, server.operationParse)
+		if err != nil {
+			return err
+		}
+
+		if ContextSubscription(ctx) {
+			return errBatchSubscription
+		}
+
+		cres, err := server.interceptors.OperationExecute(ctx, payload, server.operationExecute)
+		if err != nil {
+			return err
+		}
+
+		return server.processResults(ctx, payload, cres, func(ctx context.Context, result interface{}) error {
+			*res = result
+
+			return nil
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package wsgraphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerPlainBatch(t *testing.T) {
+	var operations int32
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlWS,
+		WithBatching(4, 2),
+		WithInterceptors(Interceptors{
+			Operation: func(
+				ctx context.Context,
+				payload *apollows.PayloadOperation,
+				handler HandlerOperation,
+			) error {
+				atomic.AddInt32(&operations, 1)
+
+				assert.GreaterOrEqual(t, ContextBatchIndex(ctx), 0)
+
+				return handler(ctx, payload)
+			},
+		}),
+	)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal([]apollows.PayloadOperation{
+		{Query: `query { getFoo }`},
+		{Query: `mutation { bar }`},
+		{Query: `subscription { fooUpdates }`},
+		{Query: `mutation { setFoo(value: 3) }`},
+	})
+
+	assert.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var pds []apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pds))
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Len(t, pds, 4)
+	assert.EqualValues(t, 4, atomic.LoadInt32(&operations))
+
+	assert.Empty(t, pds[0].Errors)
+	assert.EqualValues(t, 123, pds[0].Data["getFoo"])
+
+	assert.NotEmpty(t, pds[1].Errors)
+	assert.Contains(t, pds[1].Errors[0].Message, `Cannot query field "bar"`)
+
+	assert.NotEmpty(t, pds[2].Errors)
+	assert.Equal(t, errBatchSubscription.Error(), pds[2].Errors[0].Message)
+
+	assert.Empty(t, pds[3].Errors)
+	assert.EqualValues(t, true, pds[3].Data["setFoo"])
+
+	bs, err = json.Marshal(make([]apollows.PayloadOperation, 5))
+
+	assert.NoError(t, err)
+
+	resp, err = srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errBatchTooLarge.Error(), pd.Errors[0].Message)
+}
+
+func TestNewServerPlainBatchRejected(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS)
+
+	defer srv.Close()
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader([]byte(` [{"query":"{ getFoo }"}]`)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errBatchRejected.Error(), pd.Errors[0].Message)
+}
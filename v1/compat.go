@@ -1,6 +1,9 @@
 package wsgraphql
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // Upgrader interface used to upgrade HTTP request/response pair into a Conn
 type Upgrader interface {
@@ -14,3 +17,35 @@ type Conn interface {
 	Close(code int, message string) error
 	Subprotocol() string
 }
+
+// PollingConn is optionally implemented by Conn to support event-driven connection handling (see WithEventDriven)
+type PollingConn interface {
+	Conn
+
+	// Poll arranges onReadable to be called once, when connection has data available to read or is closed.
+	Poll(onReadable func()) error
+
+	// SetReadDeadline sets deadline for reading message once connection is readable, zero value disables it
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets deadline for writing messages, zero value disables it
+	SetWriteDeadline(t time.Time) error
+}
+
+// Message frame types, as defined by RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// FrameConn is optionally implemented by Conn to exchange raw message frames, required by subprotocol variants using
+// apollows.Codec (see WithCodec)
+type FrameConn interface {
+	Conn
+
+	// ReadMessage reads next complete message, returning its frame type
+	ReadMessage() (messageType int, data []byte, err error)
+
+	// WriteMessage writes message as frame of given type
+	WriteMessage(messageType int, data []byte) error
+}
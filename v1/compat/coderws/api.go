@@ -0,0 +1,119 @@
+// Package coderws provides compatibility for coder/websocket (formerly nhooyr.io/websocket)
+package coderws
+
+import (
+	"context"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// maxCloseReason is the largest close reason length permitted in close frame
+const maxCloseReason = 123
+
+// Wrapper for coder/websocket accept options
+type Wrapper struct {
+	*websocket.AcceptOptions
+
+	// ReadLimit sets maximum size of incoming message in bytes, library default of 32KiB is used if zero or negative
+	ReadLimit int64
+}
+
+type conn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	json   apollows.JSONCodec
+	*websocket.Conn
+}
+
+func (conn conn) ReadJSON(v interface{}) error {
+	_, data, err := conn.Conn.Read(conn.ctx)
+	if err != nil {
+		return err
+	}
+
+	return conn.json.Unmarshal(data, v)
+}
+
+func (conn conn) WriteJSON(v interface{}) error {
+	data, err := conn.json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return conn.Conn.Write(conn.ctx, websocket.MessageText, data)
+}
+
+func (conn conn) ReadMessage() (messageType int, data []byte, err error) {
+	typ, data, err := conn.Conn.Read(conn.ctx)
+
+	return int(typ), data, err
+}
+
+func (conn conn) WriteMessage(messageType int, data []byte) error {
+	return conn.Conn.Write(conn.ctx, websocket.MessageType(messageType), data)
+}
+
+func (conn conn) Close(code int, message string) error {
+	defer conn.cancel()
+
+	return conn.Conn.Close(websocket.StatusCode(code), truncateReason(message))
+}
+
+func (conn conn) Subprotocol() string {
+	return conn.Conn.Subprotocol()
+}
+
+// Upgrade implementation
+func (g Wrapper) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (wsgraphql.Conn, error) {
+	for k, vs := range responseHeader {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	c, err := websocket.Accept(w, r, g.AcceptOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.ReadLimit > 0 {
+		c.SetReadLimit(g.ReadLimit)
+	}
+
+	// request context is cancelled once reading stops, connection context is kept until outgoing messages are
+	// written and connection is closed
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return conn{
+		ctx:    ctx,
+		cancel: cancel,
+		json:   wsgraphql.ContextJSONCodec(r.Context()),
+		Conn:   c,
+	}, nil
+}
+
+// Wrap coder/websocket accept options into wsgraphql-compatible interface
+func Wrap(options *websocket.AcceptOptions) Wrapper {
+	return Wrapper{
+		AcceptOptions: options,
+	}
+}
+
+// truncateReason shortens message to fit into close frame, keeping it valid utf-8
+func truncateReason(message string) string {
+	if len(message) <= maxCloseReason {
+		return message
+	}
+
+	message = message[:maxCloseReason]
+
+	for len(message) > 0 && !utf8.ValidString(message) {
+		message = message[:len(message)-1]
+	}
+
+	return message
+}
@@ -0,0 +1,30 @@
+package coderws
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/coder/websocket"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapper(t *testing.T) {
+	wrapper := Wrap(&websocket.AcceptOptions{
+		Subprotocols: compattest.Subprotocols,
+	})
+
+	wrapper.ReadLimit = 1 << 20
+
+	compattest.RunUpgraderSuite(t, wrapper)
+}
+
+func TestTruncateReason(t *testing.T) {
+	assert.Equal(t, "foo", truncateReason("foo"))
+
+	reason := truncateReason(strings.Repeat("ж", maxCloseReason))
+
+	assert.LessOrEqual(t, len(reason), maxCloseReason)
+	assert.True(t, utf8.ValidString(reason))
+}
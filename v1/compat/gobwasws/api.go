@@ -0,0 +1,277 @@
+// Package gobwasws provides compatibility for gobwas/ws, including wsgraphql.PollingConn implementation backed by
+// epoll on linux, suitable for wsgraphql.WithEventDriven
+package gobwasws
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// maxCloseReason is the largest close reason length permitted in close frame
+const maxCloseReason = 123
+
+// Wrapper for gobwas/ws HTTP upgrader
+type Wrapper struct {
+	ws.HTTPUpgrader
+
+	// Subprotocols lists supported subprotocols, by default subprotocols configured on wsgraphql server are used.
+	// Ignored if HTTPUpgrader.Protocol is set.
+	Subprotocols []string
+
+	// ReadLimit sets maximum size of incoming frame in bytes, unlimited if zero or negative
+	ReadLimit int64
+}
+
+type conn struct {
+	netconn     net.Conn
+	reader      *bufio.Reader
+	poller      poller
+	json        apollows.JSONCodec
+	subprotocol string
+	readLimit   int64
+	fd          int
+	wm          sync.Mutex
+	pm          sync.Mutex
+	closeSent   bool
+	closed      bool
+}
+
+func (conn *conn) ReadJSON(v interface{}) error {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return conn.json.Unmarshal(data, v)
+}
+
+func (conn *conn) ReadMessage() (messageType int, data []byte, err error) {
+	rd := wsutil.Reader{
+		Source:         conn.reader,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		MaxFrameSize:   conn.readLimit,
+		OnIntermediate: conn.control,
+	}
+
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if hdr.OpCode.IsControl() {
+			err = conn.control(hdr, &rd)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			continue
+		}
+
+		data, err = ioutil.ReadAll(&rd)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return int(hdr.OpCode), data, nil
+	}
+}
+
+// control handles control frame, writing response frame at once to avoid interleaving with concurrent writes
+func (conn *conn) control(hdr ws.Header, r io.Reader) error {
+	var buf bytes.Buffer
+
+	err := wsutil.ControlHandler{
+		Src:                 r,
+		Dst:                 &buf,
+		State:               ws.StateServerSide,
+		DisableSrcCiphering: true,
+	}.Handle(hdr)
+
+	if buf.Len() > 0 {
+		conn.wm.Lock()
+
+		if !conn.closeSent {
+			_, werr := conn.netconn.Write(buf.Bytes())
+			if err == nil {
+				err = werr
+			}
+
+			conn.closeSent = hdr.OpCode == ws.OpClose
+		}
+
+		conn.wm.Unlock()
+	}
+
+	return err
+}
+
+func (conn *conn) WriteJSON(v interface{}) error {
+	data, err := conn.json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteMessage(wsgraphql.TextMessage, data)
+}
+
+func (conn *conn) WriteMessage(messageType int, data []byte) error {
+	conn.wm.Lock()
+	defer conn.wm.Unlock()
+
+	return wsutil.WriteServerMessage(conn.netconn, ws.OpCode(messageType), data)
+}
+
+func (conn *conn) Close(code int, message string) (err error) {
+	conn.wm.Lock()
+
+	if !conn.closeSent {
+		conn.closeSent = true
+
+		frame := ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusCode(code), truncateReason(message)))
+
+		err = ws.WriteFrame(conn.netconn, frame)
+	}
+
+	conn.wm.Unlock()
+
+	conn.pm.Lock()
+	defer conn.pm.Unlock()
+
+	if conn.closed {
+		return
+	}
+
+	conn.closed = true
+
+	conn.poller.remove(conn)
+
+	cerr := conn.netconn.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+func (conn *conn) Subprotocol() string {
+	return conn.subprotocol
+}
+
+// SetReadDeadline implementation
+func (conn *conn) SetReadDeadline(t time.Time) error {
+	return conn.netconn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implementation
+func (conn *conn) SetWriteDeadline(t time.Time) error {
+	return conn.netconn.SetWriteDeadline(t)
+}
+
+// Poll implementation
+func (conn *conn) Poll(onReadable func()) error {
+	conn.pm.Lock()
+	defer conn.pm.Unlock()
+
+	if conn.closed || conn.reader.Buffered() > 0 {
+		go onReadable()
+
+		return nil
+	}
+
+	return conn.poller.poll(conn, onReadable)
+}
+
+// Upgrade implementation
+func (g Wrapper) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (wsgraphql.Conn, error) {
+	upgrader := g.HTTPUpgrader
+
+	if upgrader.Protocol == nil {
+		supported := g.Subprotocols
+		if supported == nil {
+			supported = wsgraphql.ContextSubprotocols(r.Context())
+		}
+
+		upgrader.Protocol = func(protocol string) bool {
+			for _, s := range supported {
+				if s == protocol {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+
+	header := make(http.Header)
+
+	for k, vs := range g.Header {
+		header[k] = append(header[k], vs...)
+	}
+
+	for k, vs := range responseHeader {
+		header[k] = append(header[k], vs...)
+	}
+
+	upgrader.Header = header
+
+	netconn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err != nil {
+		if netconn != nil {
+			_ = netconn.Close()
+		}
+
+		return nil, err
+	}
+
+	c := &conn{
+		netconn:     netconn,
+		reader:      rw.Reader,
+		subprotocol: hs.Protocol,
+		readLimit:   g.ReadLimit,
+		fd:          -1,
+		poller:      goroutinePoller{},
+		json:        wsgraphql.ContextJSONCodec(r.Context()),
+	}
+
+	if fd, ok := connFD(netconn); ok && defaultPoller() != nil {
+		c.fd, c.poller = fd, defaultPoller()
+	}
+
+	return c, nil
+}
+
+// Wrap gobwas/ws HTTP upgrader into wsgraphql-compatible interface
+func Wrap(upgrader ws.HTTPUpgrader) Wrapper {
+	return Wrapper{
+		HTTPUpgrader: upgrader,
+	}
+}
+
+// truncateReason shortens message to fit into close frame, keeping it valid utf-8
+func truncateReason(message string) string {
+	if len(message) <= maxCloseReason {
+		return message
+	}
+
+	message = message[:maxCloseReason]
+
+	for len(message) > 0 && !utf8.ValidString(message) {
+		message = message[:len(message)-1]
+	}
+
+	return message
+}
@@ -0,0 +1,37 @@
+package gobwasws
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gobwas/ws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapper(t *testing.T) {
+	compattest.RunUpgraderSuite(t, Wrap(ws.HTTPUpgrader{}))
+}
+
+func TestWrapperEventDriven(t *testing.T) {
+	compattest.RunUpgraderSuite(t, Wrap(ws.HTTPUpgrader{}), wsgraphql.WithEventDriven())
+}
+
+func TestWrapperSubprotocols(t *testing.T) {
+	wrapper := Wrap(ws.HTTPUpgrader{})
+
+	wrapper.Subprotocols = compattest.Subprotocols
+
+	compattest.RunUpgraderSuite(t, wrapper, wsgraphql.WithEventDriven())
+}
+
+func TestTruncateReason(t *testing.T) {
+	assert.Equal(t, "foo", truncateReason("foo"))
+
+	reason := truncateReason(strings.Repeat("ж", maxCloseReason))
+
+	assert.LessOrEqual(t, len(reason), maxCloseReason)
+	assert.True(t, utf8.ValidString(reason))
+}
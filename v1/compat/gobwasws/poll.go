@@ -0,0 +1,53 @@
+package gobwasws
+
+import (
+	"net"
+	"syscall"
+)
+
+// poller notifies about connection readability
+type poller interface {
+	// poll arranges onReadable to be called once, when connection has data available to read or is closed
+	poll(c *conn, onReadable func()) error
+
+	// remove cancels pending notification, invoking its callback, must be called before connection is closed
+	remove(c *conn)
+}
+
+// goroutinePoller is used when platform poller is unavailable, awaiting readability in a dedicated goroutine
+type goroutinePoller struct{}
+
+func (goroutinePoller) poll(c *conn, onReadable func()) error {
+	go func() {
+		// error is observed by subsequent read
+		_, _ = c.reader.Peek(1)
+
+		onReadable()
+	}()
+
+	return nil
+}
+
+// remove is no-op, as closing the connection interrupts pending peek
+func (goroutinePoller) remove(*conn) {}
+
+func connFD(netconn net.Conn) (fd int, ok bool) {
+	sc, ok := netconn.(syscall.Conn)
+	if !ok {
+		return -1, false
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return -1, false
+	}
+
+	err = rc.Control(func(rawfd uintptr) {
+		fd = int(rawfd)
+	})
+	if err != nil {
+		return -1, false
+	}
+
+	return fd, true
+}
@@ -0,0 +1,110 @@
+//go:build linux
+// +build linux
+
+package gobwasws
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+)
+
+var (
+	epollInstance *epoll
+	epollOnce     sync.Once
+)
+
+// defaultPoller returns process-wide epoll instance, or nil if it could not be created
+func defaultPoller() poller {
+	epollOnce.Do(func() {
+		fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			return
+		}
+
+		epollInstance = &epoll{
+			callbacks: make(map[int]func()),
+			fd:        fd,
+		}
+
+		go epollInstance.wait()
+	})
+
+	if epollInstance == nil {
+		return nil
+	}
+
+	return epollInstance
+}
+
+// epoll awaits readability of registered connections using single goroutine, notifications are one-shot
+type epoll struct {
+	callbacks map[int]func()
+	fd        int
+	m         sync.Mutex
+}
+
+func (p *epoll) poll(c *conn, onReadable func()) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.callbacks[c.fd] = onReadable
+
+	ev := syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT,
+		Fd:     int32(c.fd),
+	}
+
+	err := syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, c.fd, &ev)
+	if errors.Is(err, syscall.ENOENT) {
+		err = syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, c.fd, &ev)
+	}
+
+	if err != nil {
+		delete(p.callbacks, c.fd)
+	}
+
+	return err
+}
+
+func (p *epoll) remove(c *conn) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	_ = syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, c.fd, nil)
+
+	onReadable, ok := p.callbacks[c.fd]
+	if ok {
+		delete(p.callbacks, c.fd)
+
+		go onReadable()
+	}
+}
+
+func (p *epoll) wait() {
+	events := make([]syscall.EpollEvent, 128)
+
+	for {
+		n, err := syscall.EpollWait(p.fd, events, -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		p.m.Lock()
+
+		for _, ev := range events[:n] {
+			onReadable, ok := p.callbacks[int(ev.Fd)]
+			if ok {
+				delete(p.callbacks, int(ev.Fd))
+
+				go onReadable()
+			}
+		}
+
+		p.m.Unlock()
+	}
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package gobwasws
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gobwas/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventDrivenIdleConnections(t *testing.T) {
+	const count = 200
+
+	srv := compattest.NewServer(t, Wrap(ws.HTTPUpgrader{}), wsgraphql.WithEventDriven())
+
+	defer srv.Close()
+
+	before := runtime.NumGoroutine()
+
+	var conns []*websocket.Conn
+
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	for i := 0; i < count; i++ {
+		conn := compattest.Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			Type: apollows.OperationConnectionInit,
+		}))
+
+		var msg apollows.Message
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+		conns = append(conns, conn)
+	}
+
+	// allow finished handler goroutines to exit
+	time.Sleep(time.Millisecond * 100)
+
+	assert.Less(t, runtime.NumGoroutine()-before, count/10)
+}
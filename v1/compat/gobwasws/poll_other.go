@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package gobwasws
+
+// defaultPoller returns nil, as platform poller is not implemented, goroutinePoller is used instead
+func defaultPoller() poller {
+	return nil
+}
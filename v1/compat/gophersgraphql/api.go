@@ -0,0 +1,138 @@
+// Package gophersgraphql provides wsgraphql.Executor using graph-gophers/graphql-go schema
+package gophersgraphql
+
+import (
+	"context"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	gophers "github.com/graph-gophers/graphql-go"
+	gopherserrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/printer"
+)
+
+type executor struct {
+	schema *gophers.Schema
+}
+
+// NewExecutor returns wsgraphql.Executor using provided graph-gophers schema, which should be created with a resolver
+func NewExecutor(schema *gophers.Schema) wsgraphql.Executor {
+	return executor{
+		schema: schema,
+	}
+}
+
+// Validate implementation
+func (executor executor) Validate(_ context.Context, params *wsgraphql.ExecuteParams) []gqlerrors.FormattedError {
+	return convertErrors(executor.schema.ValidateWithVariables(query(params), params.Variables))
+}
+
+// Execute implementation, response data is decoded with JSON codec of the server
+func (executor executor) Execute(
+	ctx context.Context,
+	params *wsgraphql.ExecuteParams,
+) (chan *graphql.Result, error) {
+	codec := wsgraphql.ContextJSONCodec(ctx)
+
+	if !params.Subscription {
+		cres := make(chan *graphql.Result, 1)
+		cres <- convertResponse(codec, executor.schema.Exec(ctx, query(params), params.OperationName, params.Variables))
+		close(cres)
+
+		return cres, nil
+	}
+
+	responses, err := executor.schema.Subscribe(ctx, query(params), params.OperationName, params.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	cres := make(chan *graphql.Result)
+
+	go func() {
+		defer close(cres)
+
+		// responses are drained until closed by graph-gophers once ctx is done
+		for v := range responses {
+			resp, ok := v.(*gophers.Response)
+			if !ok {
+				continue
+			}
+
+			select {
+			case cres <- convertResponse(codec, resp):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return cres, nil
+}
+
+// query returns operation source, printing the document if it was rewritten by the server
+func query(params *wsgraphql.ExecuteParams) string {
+	if params.Query != "" || params.Document == nil {
+		return params.Query
+	}
+
+	s, _ := printer.Print(params.Document).(string)
+
+	return s
+}
+
+func convertResponse(codec apollows.JSONUnmarshaler, resp *gophers.Response) *graphql.Result {
+	result := &graphql.Result{
+		Errors:     convertErrors(resp.Errors),
+		Extensions: resp.Extensions,
+	}
+
+	if len(resp.Data) == 0 {
+		return result
+	}
+
+	var data map[string]interface{}
+
+	err := codec.Unmarshal(resp.Data, &data)
+	if err != nil {
+		result.Errors = append(result.Errors, gqlerrors.FormatError(err))
+
+		return result
+	}
+
+	if data != nil {
+		result.Data = data
+	}
+
+	return result
+}
+
+func convertErrors(errs []*gopherserrors.QueryError) []gqlerrors.FormattedError {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	res := make([]gqlerrors.FormattedError, 0, len(errs))
+
+	for _, err := range errs {
+		formatted := gqlerrors.FormatError(err)
+
+		formatted.Message = err.Message
+		formatted.Path = err.Path
+		formatted.Extensions = err.Extensions
+		formatted.Locations = make([]location.SourceLocation, 0, len(err.Locations))
+
+		for _, loc := range err.Locations {
+			formatted.Locations = append(formatted.Locations, location.SourceLocation{
+				Line:   loc.Line,
+				Column: loc.Column,
+			})
+		}
+
+		res = append(res, formatted)
+	}
+
+	return res
+}
@@ -0,0 +1,201 @@
+package gophersgraphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/gorilla/websocket"
+	gophers "github.com/graph-gophers/graphql-go"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `
+	schema {
+		query: Query
+		subscription: Subscription
+	}
+
+	type Query {
+		getFoo: Int!
+		echo(value: String!): String!
+	}
+
+	type Subscription {
+		fooUpdates: Int!
+	}
+`
+
+type testResolver struct{}
+
+func (*testResolver) GetFoo() int32 {
+	return 123
+}
+
+func (*testResolver) Echo(args struct{ Value string }) string {
+	return args.Value
+}
+
+func (*testResolver) FooUpdates(ctx context.Context) <-chan int32 {
+	ch := make(chan int32)
+
+	go func() {
+		defer close(ch)
+
+		for i := int32(1); i <= 3; i++ {
+			select {
+			case ch <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	server, err := wsgraphql.NewServer(
+		graphql.Schema{},
+		wsgraphql.WithExecutor(NewExecutor(gophers.MustParseSchema(testSchema, &testResolver{}))),
+		wsgraphql.WithUpgrader(gorillaws.Wrap(&websocket.Upgrader{
+			Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+		})),
+	)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func testPost(t *testing.T, srv *httptest.Server, payload apollows.PayloadOperation) (res struct {
+	Data   map[string]interface{}   `json:"data"`
+	Errors []map[string]interface{} `json:"errors"`
+}) {
+	bs, err := json.Marshal(payload)
+
+	assert.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+	return
+}
+
+func TestExecutorHTTP(t *testing.T) {
+	srv := testServer(t)
+
+	defer srv.Close()
+
+	res := testPost(t, srv, apollows.PayloadOperation{
+		Query: `query ($value: String!) { getFoo echo(value: $value) }`,
+		Variables: map[string]interface{}{
+			"value": "bar",
+		},
+	})
+
+	assert.Empty(t, res.Errors)
+	assert.EqualValues(t, 123, res.Data["getFoo"])
+	assert.Equal(t, "bar", res.Data["echo"])
+
+	res = testPost(t, srv, apollows.PayloadOperation{
+		Query: `query { unknown }`,
+	})
+
+	assert.Nil(t, res.Data)
+	assert.Len(t, res.Errors, 1)
+	assert.Contains(t, res.Errors[0]["message"], "unknown")
+}
+
+func TestExecutorRewrittenDocument(t *testing.T) {
+	astdoc, err := parser.Parse(parser.ParseParams{
+		Source: `query { getFoo }`,
+	})
+
+	assert.NoError(t, err)
+
+	executor := NewExecutor(gophers.MustParseSchema(testSchema, &testResolver{}))
+
+	cres, err := executor.Execute(context.Background(), &wsgraphql.ExecuteParams{
+		Document: astdoc,
+	})
+
+	assert.NoError(t, err)
+
+	result := <-cres
+
+	assert.Empty(t, result.Errors)
+	assert.EqualValues(t, 123, result.Data.(map[string]interface{})["getFoo"])
+}
+
+func TestExecutorSubscription(t *testing.T) {
+	srv := testServer(t)
+
+	defer srv.Close()
+
+	dialer := websocket.Dialer{
+		Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	}
+
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	}))
+
+	for i := 1; i <= 3; i++ {
+		msg = apollows.Message{}
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		pd, err := msg.Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, i, pd.Data["fooUpdates"])
+	}
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+}
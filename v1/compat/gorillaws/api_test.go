@@ -0,0 +1,14 @@
+package gorillaws
+
+import (
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gorilla/websocket"
+)
+
+func TestWrapper(t *testing.T) {
+	compattest.RunUpgraderSuite(t, Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}))
+}
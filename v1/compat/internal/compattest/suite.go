@@ -0,0 +1,378 @@
+// Package compattest provides test suite shared by websocket compatibility packages
+package compattest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/apollows/msgpack"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+// Subprotocols lists subprotocols upgraders under test are expected to negotiate
+var Subprotocols = []string{
+	apollows.WebsocketSubprotocolGraphqlWS.String(),
+	apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+	apollows.WebsocketSubprotocolGraphqlTransportWS.Variant(msgpack.Codec{}),
+}
+
+// NewSchema returns schema used by the suite
+func NewSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+				"echo": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{
+						"value": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Args["value"], nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"fooUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{}, 3)
+
+						ch <- 1
+						ch <- 2
+						ch <- 3
+
+						close(ch)
+
+						return ch, nil
+					},
+				},
+				"forever": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						return make(chan interface{}), nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+// NewServer returns test server serving the suite schema using provided upgrader
+func NewServer(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) *httptest.Server {
+	server, err := wsgraphql.NewServer(NewSchema(t), append([]wsgraphql.ServerOption{
+		wsgraphql.WithUpgrader(upgrader),
+		wsgraphql.WithConnectTimeout(time.Second),
+	}, opts...)...)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+// Dial connects to the test server using given subprotocol
+func Dial(t *testing.T, srv *httptest.Server, protocol apollows.Protocol) *websocket.Conn {
+	conn := dial(t, srv, protocol)
+
+	assert.Equal(t, protocol.String(), conn.Subprotocol())
+
+	return conn
+}
+
+func dial(t *testing.T, srv *httptest.Server, protocol apollows.Protocol) *websocket.Conn {
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dialer := websocket.Dialer{
+		Subprotocols: []string{protocol.String()},
+	}
+
+	conn, resp, err := dialer.Dial(u, http.Header{})
+
+	assert.NoError(t, err)
+
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return conn
+}
+
+func initialize(t *testing.T, conn *websocket.Conn) {
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+}
+
+func read(t *testing.T, conn *websocket.Conn, id string, typ apollows.Operation) *apollows.Message {
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, id, msg.ID)
+	assert.Equal(t, typ, msg.Type)
+
+	return &msg
+}
+
+// RunUpgraderSuite runs common scenarios against the server using provided upgrader and extra server options
+func RunUpgraderSuite(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) {
+	t.Run("GraphqlWS", func(t *testing.T) {
+		testProtocol(t, upgrader, apollows.WebsocketSubprotocolGraphqlWS, opts...)
+	})
+
+	t.Run("GraphqlTransportWS", func(t *testing.T) {
+		testProtocol(t, upgrader, apollows.WebsocketSubprotocolGraphqlTransportWS, opts...)
+	})
+
+	t.Run("Codec", func(t *testing.T) {
+		testCodec(t, upgrader, opts...)
+	})
+
+	t.Run("LargeMessage", func(t *testing.T) {
+		testLargeMessage(t, upgrader, opts...)
+	})
+
+	t.Run("CloseCode", func(t *testing.T) {
+		testCloseCode(t, upgrader, opts...)
+	})
+
+	t.Run("UnknownProtocol", func(t *testing.T) {
+		testUnknownProtocol(t, upgrader, opts...)
+	})
+}
+
+func testProtocol(
+	t *testing.T,
+	upgrader wsgraphql.Upgrader,
+	protocol apollows.Protocol,
+	opts ...wsgraphql.ServerOption,
+) {
+	srv := NewServer(t, upgrader, opts...)
+
+	defer srv.Close()
+
+	conn := Dial(t, srv, protocol)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	initialize(t, conn)
+
+	start, next := apollows.OperationStart, apollows.OperationData
+
+	if protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
+		start, next = apollows.OperationSubscribe, apollows.OperationNext
+	}
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: start,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+			},
+		},
+	}))
+
+	pd, err := read(t, conn, "1", next).Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	read(t, conn, "1", apollows.OperationComplete)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "2",
+		Type: start,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	}))
+
+	for i := 1; i <= 3; i++ {
+		pd, err = read(t, conn, "2", next).Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, i, pd.Data["fooUpdates"])
+	}
+
+	read(t, conn, "2", apollows.OperationComplete)
+
+	if protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			Type: apollows.OperationPing,
+		}))
+
+		read(t, conn, "", apollows.OperationPong)
+	}
+}
+
+func testCodec(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) {
+	srv := NewServer(t, upgrader, append(opts, wsgraphql.WithCodec(msgpack.Codec{}))...)
+
+	defer srv.Close()
+
+	codec := msgpack.Codec{}
+	conn := Dial(t, srv, apollows.Protocol(apollows.WebsocketSubprotocolGraphqlTransportWS.Variant(codec)))
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	write := func(msg *apollows.Message) {
+		data, err := codec.Marshal(msg)
+
+		assert.NoError(t, err)
+		assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, data))
+	}
+
+	read := func(id string, typ apollows.Operation) *apollows.Message {
+		messageType, data, err := conn.ReadMessage()
+
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+
+		var msg apollows.Message
+
+		assert.NoError(t, codec.Unmarshal(data, &msg))
+		assert.Equal(t, id, msg.ID)
+		assert.Equal(t, typ, msg.Type)
+
+		return &msg
+	}
+
+	write(&apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	})
+
+	read("", apollows.OperationConnectionAck)
+
+	write(&apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+			},
+		},
+	})
+
+	pd, err := read("1", apollows.OperationNext).Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	read("1", apollows.OperationComplete)
+}
+
+func testLargeMessage(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) {
+	srv := NewServer(t, upgrader, opts...)
+
+	defer srv.Close()
+
+	conn := Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	initialize(t, conn)
+
+	value := strings.Repeat("a", 1<<16)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query ($value: String) { echo(value: $value) }`,
+				Variables: map[string]interface{}{
+					"value": value,
+				},
+			},
+		},
+	}))
+
+	pd, err := read(t, conn, "1", apollows.OperationNext).Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.Equal(t, value, pd.Data["echo"])
+}
+
+func testCloseCode(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) {
+	srv := NewServer(t, upgrader, opts...)
+
+	defer srv.Close()
+
+	conn := Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	initialize(t, conn)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	err := conn.ReadJSON(&msg)
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventTooManyInitializationRequests)), "%v", err)
+}
+
+func testUnknownProtocol(t *testing.T, upgrader wsgraphql.Upgrader, opts ...wsgraphql.ServerOption) {
+	srv := NewServer(t, upgrader, append(opts, wsgraphql.WithProtocol(apollows.WebsocketSubprotocolGraphqlWS))...)
+
+	defer srv.Close()
+
+	// upgrader may either reject the subprotocol during handshake or negotiate one unsupported by the server
+	conn := dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var msg apollows.Message
+
+	err := conn.ReadJSON(&msg)
+
+	assert.ErrorContains(t, err, apollows.ErrUnknownProtocol.Error())
+}
@@ -10,6 +10,8 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -32,11 +34,17 @@ type OperationOption interface {
 
 // NewOperationInterceptor returns new otel-span reporting wsgraphql operation interceptor
 func NewOperationInterceptor(options ...OperationOption) wsgraphql.InterceptorOperation {
+	return newOperationConfig(options).interceptOperation
+}
+
+func newOperationConfig(options []OperationOption) *operationConfig {
 	var c operationConfig
 
 	defaultOptions := []OperationOption{
 		WithSpanNameResolver(DefaultSpanNameResolver),
 		WithSpanAttributesResolver(DefaultSpanAttributesResolver),
+		WithSpanASTNameResolver(DefaultSpanASTNameResolver),
+		WithSpanASTAttributesResolver(DefaultSpanASTAttributesResolver),
 		WithStartSpanOptions(trace.WithSpanKind(trace.SpanKindServer)),
 	}
 
@@ -44,39 +52,63 @@ func NewOperationInterceptor(options ...OperationOption) wsgraphql.InterceptorOp
 		o.applyOperation(&c)
 	}
 
-	return func(ctx context.Context, payload *apollows.PayloadOperation, handler wsgraphql.HandlerOperation) error {
-		tracer := c.tracer
-
-		if tracer == nil {
-			if c.tracerProvider != nil {
-				tracer = newTracer(c.tracerProvider)
-			} else if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
-				tracer = newTracer(span.TracerProvider())
-			} else {
-				tracer = newTracer(otel.GetTracerProvider())
-			}
-		}
+	return &c
+}
 
-		opts := append(
-			[]trace.SpanStartOption{trace.WithAttributes(c.attributesResolver(ctx, payload)...)},
-			c.startSpanOptions...,
-		)
+func (c *operationConfig) interceptOperation(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperation,
+) error {
+	tracer := c.resolveTracer(ctx)
 
-		ctx, span := tracer.Start(ctx, c.nameResolver(ctx, payload), opts...)
+	ctx, links := c.propagatedContext(ctx, payload)
 
-		err := handler(ctx, payload)
+	opts := append(
+		[]trace.SpanStartOption{
+			trace.WithAttributes(c.redactAttributes(c.attributesResolver(ctx, payload))...),
+			trace.WithLinks(links...),
+		},
+		c.startSpanOptions...,
+	)
 
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-		} else {
-			span.SetStatus(codes.Ok, "")
-		}
+	ctx, span := tracer.Start(ctx, c.nameResolver(ctx, payload), opts...)
+
+	err := handler(ctx, payload)
 
-		span.End()
+	c.resolveASTSpan(ctx, span, payload)
 
-		return err
+	endSpan(span, err)
+
+	return err
+}
+
+// resolveTracer returns configured tracer, or one of the provider of span in the context, or the global one
+func (c *operationConfig) resolveTracer(ctx context.Context) trace.Tracer {
+	switch {
+	case c.tracer != nil:
+		return c.tracer
+	case c.tracerProvider != nil:
+		return newTracer(c.tracerProvider)
+	}
+
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return newTracer(span.TracerProvider())
+	}
+
+	return newTracer(otel.GetTracerProvider())
+}
+
+// endSpan sets span status from the error and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "")
 	}
+
+	span.End()
 }
 
 // SpanNameResolver determined span name from payload operation
@@ -123,9 +155,10 @@ func WithSpanAttributesResolver(resolver SpanAttributesResolver) OperationOption
 	})
 }
 
-var queryRegex = regexp.MustCompile(`(query|mutation|subscription)\s*(\w*)`)
+var queryRegex = regexp.MustCompile(`\b(query|mutation|subscription)\b\s*(\w*)`)
 
-// DefaultSpanNameResolver default span name resolver function
+// DefaultSpanNameResolver default span name resolver function, guessing operation type and name from the document
+// text, as span is started before the document is parsed
 func DefaultSpanNameResolver(_ context.Context, payload *apollows.PayloadOperation) string {
 	parts := queryRegex.FindStringSubmatch(payload.Query)
 	name := payload.OperationName
@@ -185,11 +218,18 @@ func DefaultSpanAttributesResolver(
 }
 
 type operationConfig struct {
-	nameResolver       SpanNameResolver
-	attributesResolver SpanAttributesResolver
-	tracer             trace.Tracer
-	tracerProvider     trace.TracerProvider
-	startSpanOptions   []trace.SpanStartOption
+	nameResolver          SpanNameResolver
+	attributesResolver    SpanAttributesResolver
+	astNameResolver       SpanASTNameResolver
+	astAttributesResolver SpanASTAttributesResolver
+	tracer                trace.Tracer
+	tracerProvider        trace.TracerProvider
+	meter                 metric.Meter
+	meterProvider         metric.MeterProvider
+	propagator            propagation.TextMapPropagator
+	startSpanOptions      []trace.SpanStartOption
+	operationNames        map[string]struct{}
+	redactDocument        bool
 }
 
 type optionFunc func(c *operationConfig)
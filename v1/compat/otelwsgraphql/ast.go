@@ -0,0 +1,168 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// RootFieldsKey is attribute key of root field names selected by the operation
+	RootFieldsKey = attribute.Key("graphql.operation.root_fields")
+	// DocumentHashKey is attribute key of hex-encoded SHA-256 hash of the operation document
+	DocumentHashKey = attribute.Key("graphql.document.hash")
+)
+
+// SpanASTNameResolver determines span name from payload operation after AST parsing
+type SpanASTNameResolver func(ctx context.Context, payload *apollows.PayloadOperation) string
+
+// WithSpanASTNameResolver provides custom name resolver, used once operation is parsed
+func WithSpanASTNameResolver(resolver SpanASTNameResolver) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.astNameResolver = resolver
+	})
+}
+
+// WithSpanASTAttributesResolver provides custom attributes resolver, used once operation is parsed
+func WithSpanASTAttributesResolver(resolver SpanASTAttributesResolver) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.astAttributesResolver = resolver
+	})
+}
+
+// WithRedactedDocument omits graphql.document attribute, operation document remains identified by its hash
+func WithRedactedDocument() OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.redactDocument = true
+	})
+}
+
+// DefaultSpanASTNameResolver default span name resolver function, used once operation is parsed
+func DefaultSpanASTNameResolver(ctx context.Context, payload *apollows.PayloadOperation) string {
+	op := wsgraphql.ContextOperationDefinition(ctx)
+	if op == nil {
+		return DefaultSpanNameResolver(ctx, payload)
+	}
+
+	if op.Name == nil || op.Name.Value == "" {
+		return "gql." + op.Operation
+	}
+
+	return "gql." + op.Operation + "." + op.Name.Value
+}
+
+// DefaultSpanASTAttributesResolver default span attributes resolver function, used once operation is parsed;
+// operation type and name replace ones guessed by DefaultSpanAttributesResolver
+func DefaultSpanASTAttributesResolver(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+) (attrs []attribute.KeyValue) {
+	astdoc := wsgraphql.ContextAST(ctx)
+
+	op := wsgraphql.ContextOperationDefinition(ctx)
+	if op == nil {
+		return DefaultSpanAttributesResolver(ctx, payload)
+	}
+
+	switch op.Operation {
+	case ast.OperationTypeSubscription:
+		attrs = append(attrs, semconv.GraphqlOperationTypeSubscription)
+	case ast.OperationTypeMutation:
+		attrs = append(attrs, semconv.GraphqlOperationTypeMutation)
+	default:
+		attrs = append(attrs, semconv.GraphqlOperationTypeQuery)
+	}
+
+	// name of anonymous operation is set empty, overwriting one guessed when span was started
+	var name string
+
+	if op.Name != nil {
+		name = op.Name.Value
+	}
+
+	attrs = append(attrs, semconv.GraphqlOperationName(name))
+
+	if fields := rootFields(astdoc, op.SelectionSet, nil); len(fields) > 0 {
+		attrs = append(attrs, RootFieldsKey.StringSlice(fields))
+	}
+
+	hash := sha256.Sum256([]byte(payload.Query))
+
+	attrs = append(
+		attrs,
+		DocumentHashKey.String(hex.EncodeToString(hash[:])),
+		semconv.GraphqlDocument(payload.Query),
+	)
+
+	return
+}
+
+// resolveASTSpan renames and annotates operation span once operation is parsed
+func (c *operationConfig) resolveASTSpan(ctx context.Context, span trace.Span, payload *apollows.PayloadOperation) {
+	if wsgraphql.ContextAST(ctx) == nil {
+		return
+	}
+
+	span.SetName(c.astNameResolver(ctx, payload))
+	span.SetAttributes(c.redactAttributes(c.astAttributesResolver(ctx, payload))...)
+}
+
+// redactAttributes removes graphql.document attribute if WithRedactedDocument option is set
+func (c *operationConfig) redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if !c.redactDocument {
+		return attrs
+	}
+
+	res := make([]attribute.KeyValue, 0, len(attrs))
+
+	for _, attr := range attrs {
+		if attr.Key != semconv.GraphqlDocumentKey {
+			res = append(res, attr)
+		}
+	}
+
+	return res
+}
+
+// rootFields returns names of fields selected by selection set, including ones of fragments
+func rootFields(astdoc *ast.Document, set *ast.SelectionSet, visited map[string]struct{}) (fields []string) {
+	if set == nil {
+		return nil
+	}
+
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, selection.Name.Value)
+		case *ast.InlineFragment:
+			fields = append(fields, rootFields(astdoc, selection.SelectionSet, visited)...)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+
+			if _, ok := visited[name]; ok {
+				continue
+			}
+
+			if visited == nil {
+				visited = make(map[string]struct{})
+			}
+
+			visited[name] = struct{}{}
+
+			for _, definition := range astdoc.Definitions {
+				if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name.Value == name {
+					fields = append(fields, rootFields(astdoc, fragment.SelectionSet, visited)...)
+				}
+			}
+		}
+	}
+
+	return
+}
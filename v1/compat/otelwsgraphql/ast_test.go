@@ -0,0 +1,169 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+)
+
+func TestDefaultSpanASTResolvers(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		query         string
+		operationName string
+		spanName      string
+		operationType string
+		rootFields    []string
+		definition    int
+	}{
+		{
+			name:          "fragment first",
+			query:         `fragment F on SubscriptionRoot { fooUpdates } subscription Foo { ...F }`,
+			spanName:      "gql.subscription.Foo",
+			operationType: "subscription",
+			rootFields:    []string{"fooUpdates"},
+			definition:    1,
+		},
+		{
+			name:          "multiple operations",
+			query:         `query Foo { getFoo } mutation Bar { setFoo } subscription Baz { fooUpdates }`,
+			operationName: "Bar",
+			spanName:      "gql.mutation.Bar",
+			operationType: "mutation",
+			rootFields:    []string{"setFoo"},
+			definition:    1,
+		},
+		{
+			name: "comment",
+			query: `# subscription Foo
+query { getFoo echo }`,
+			spanName:      "gql.query",
+			operationType: "query",
+			rootFields:    []string{"getFoo", "echo"},
+		},
+		{
+			name:          "shorthand",
+			query:         `{ getFoo ... on QueryRoot { echo } }`,
+			spanName:      "gql.query",
+			operationType: "query",
+			rootFields:    []string{"getFoo", "echo"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			astdoc, err := parser.Parse(parser.ParseParams{Source: c.query})
+
+			assert.NoError(t, err)
+
+			// operation is selected by the server during parsing
+			ctx := context.WithValue(context.Background(), wsgraphql.ContextKeyAST, astdoc)
+			ctx = context.WithValue(ctx, wsgraphql.ContextKeyOperationDefinition, astdoc.Definitions[c.definition])
+
+			payload := &apollows.PayloadOperation{
+				Query:         c.query,
+				OperationName: c.operationName,
+			}
+
+			assert.Equal(t, c.spanName, DefaultSpanASTNameResolver(ctx, payload))
+
+			attrs := attribute.NewSet(DefaultSpanASTAttributesResolver(ctx, payload)...)
+
+			v, _ := attrs.Value(semconv.GraphqlOperationTypeKey)
+			assert.Equal(t, c.operationType, v.AsString())
+
+			v, _ = attrs.Value(RootFieldsKey)
+			assert.Equal(t, c.rootFields, v.AsStringSlice())
+
+			assert.True(t, attrs.HasValue(DocumentHashKey))
+			assert.True(t, attrs.HasValue(semconv.GraphqlDocumentKey))
+		})
+	}
+}
+
+func TestWithRedactedDocument(t *testing.T) {
+	tracer := &testTracer{}
+
+	query := `fragment F on QueryRoot { getFoo } query Foo { ...F }`
+
+	astdoc, err := parser.Parse(parser.ParseParams{Source: query})
+
+	assert.NoError(t, err)
+
+	opctx := mutable.NewMutableContext(context.Background())
+
+	interceptor := NewOperationInterceptor(WithTracer(tracer), WithRedactedDocument())
+
+	err = interceptor(opctx, &apollows.PayloadOperation{
+		Query: query,
+	}, func(ctx context.Context, payload *apollows.PayloadOperation) error {
+		opctx.Set(wsgraphql.ContextKeyAST, astdoc)
+		opctx.Set(wsgraphql.ContextKeyOperationDefinition, astdoc.Definitions[1])
+
+		return nil
+	})
+
+	assert.NoError(t, err)
+
+	if assert.Len(t, tracer.spans, 1) {
+		span := tracer.spans[0].snapshot()
+
+		assert.Equal(t, "gql.query.Foo", span.name)
+		assert.Equal(t, "query", span.attrs[semconv.GraphqlOperationTypeKey].AsString())
+		assert.NotEmpty(t, span.attrs[DocumentHashKey].AsString())
+		assert.NotContains(t, span.attrs, semconv.GraphqlDocumentKey)
+	}
+}
+
+func TestASTSpanReplacesGuess(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "field prefix",
+			query: `{ subscriptionCount }`,
+		},
+		{
+			name: "comment",
+			query: `# subscription Foo
+{ getFoo }`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tracer := &testTracer{}
+
+			astdoc, err := parser.Parse(parser.ParseParams{Source: c.query})
+
+			assert.NoError(t, err)
+
+			opctx := mutable.NewMutableContext(context.Background())
+
+			interceptor := NewOperationInterceptor(WithTracer(tracer))
+
+			err = interceptor(opctx, &apollows.PayloadOperation{
+				Query: c.query,
+			}, func(ctx context.Context, payload *apollows.PayloadOperation) error {
+				opctx.Set(wsgraphql.ContextKeyAST, astdoc)
+				opctx.Set(wsgraphql.ContextKeyOperationDefinition, astdoc.Definitions[0])
+
+				return nil
+			})
+
+			assert.NoError(t, err)
+
+			if assert.Len(t, tracer.spans, 1) {
+				span := tracer.spans[0].snapshot()
+
+				assert.Equal(t, "gql.query", span.name)
+				assert.Equal(t, "query", span.attrs[semconv.GraphqlOperationTypeKey].AsString())
+				assert.Empty(t, span.attrs[semconv.GraphqlOperationNameKey].AsString())
+			}
+		})
+	}
+}
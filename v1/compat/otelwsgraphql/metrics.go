@@ -0,0 +1,295 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+)
+
+const (
+	messageDirectionSent     = "sent"
+	messageDirectionReceived = "received"
+)
+
+// operationNameOther is name attribute of named operations not in the allow-list
+const operationNameOther = "other"
+
+var (
+	// SubprotocolKey is attribute key of negotiated websocket subprotocol
+	SubprotocolKey = attribute.Key("websocket.subprotocol")
+	// CloseCodeKey is attribute key of websocket close code sent by the server
+	CloseCodeKey = attribute.Key("websocket.close_code")
+	// MessageTypeKey is attribute key of websocket protocol message type
+	MessageTypeKey = attribute.Key("websocket.message.type")
+	// MessageDirectionKey is attribute key of websocket message direction, either sent or received
+	MessageDirectionKey = attribute.Key("websocket.message.direction")
+)
+
+// WithMeter provides predefined meter instance
+func WithMeter(meter metric.Meter) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.meter = meter
+	})
+}
+
+// WithMeterProvider sets predefined meter provider instance
+func WithMeterProvider(meterProvider metric.MeterProvider) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.meterProvider = meterProvider
+	})
+}
+
+// WithOperationNames sets allow-list of operation names recorded as graphql.operation.name metric attribute, other
+// named operations are recorded as "other", keeping attribute cardinality bounded; by default all named operations
+// are recorded as "other"
+func WithOperationNames(names ...string) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.operationNames = make(map[string]struct{}, len(names))
+
+		for _, name := range names {
+			c.operationNames[name] = struct{}{}
+		}
+	})
+}
+
+// NewMetricsInterceptors returns interceptors recording metrics of websocket connections, messages and operations, to
+// be used with wsgraphql.WithExtraInterceptors. Operation attributes are type and name of the operation selected
+// from parsed document, recorded once operation is over; names are bounded by WithOperationNames.
+func NewMetricsInterceptors(options ...OperationOption) (wsgraphql.Interceptors, error) {
+	var c operationConfig
+
+	for _, o := range options {
+		o.applyOperation(&c)
+	}
+
+	meter := c.meter
+
+	if meter == nil {
+		if c.meterProvider == nil {
+			c.meterProvider = otel.GetMeterProvider()
+		}
+
+		meter = c.meterProvider.Meter(instrumentationName, metric.WithInstrumentationVersion(instrumentationVersion))
+	}
+
+	m, err := newMetrics(meter)
+	if err != nil {
+		return wsgraphql.Interceptors{}, err
+	}
+
+	m.operationNames = c.operationNames
+
+	return wsgraphql.Interceptors{
+		HTTPRequest: m.interceptHTTPRequest,
+		Operation:   m.interceptOperation,
+	}, nil
+}
+
+type metrics struct {
+	operationNames     map[string]struct{}
+	connectionsActive  metric.Int64UpDownCounter
+	connectionDuration metric.Float64Histogram
+	messages           metric.Int64Counter
+	messageSize        metric.Int64Histogram
+	operations         metric.Int64Counter
+	operationErrors    metric.Int64Counter
+	operationDuration  metric.Float64Histogram
+}
+
+func newMetrics(meter metric.Meter) (m *metrics, err error) {
+	m = &metrics{}
+
+	m.connectionsActive, err = meter.Int64UpDownCounter(
+		"wsgraphql.connection.active",
+		metric.WithDescription("Number of active websocket connections"),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.connectionDuration, err = meter.Float64Histogram(
+		"wsgraphql.connection.duration",
+		metric.WithDescription("Duration of websocket connections"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.messages, err = meter.Int64Counter(
+		"wsgraphql.message.count",
+		metric.WithDescription("Number of websocket messages"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.messageSize, err = meter.Int64Histogram(
+		"wsgraphql.message.size",
+		metric.WithDescription("Size of websocket messages encoded by the server"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.operations, err = meter.Int64Counter(
+		"wsgraphql.operation.count",
+		metric.WithDescription("Number of graphql operations"),
+		metric.WithUnit("{operation}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.operationErrors, err = meter.Int64Counter(
+		"wsgraphql.operation.errors",
+		metric.WithDescription("Number of graphql operations completed with errors"),
+		metric.WithUnit("{operation}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.operationDuration, err = meter.Float64Histogram(
+		"wsgraphql.operation.duration",
+		metric.WithDescription("Duration of graphql operations, including subscriptions lifetime"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *metrics) interceptHTTPRequest(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	handler wsgraphql.HandlerHTTPRequest,
+) error {
+	wsgraphql.ObserveWebsocket(ctx, &metricsObserver{
+		metrics: m,
+	})
+
+	return handler(ctx, w, r)
+}
+
+func (m *metrics) interceptOperation(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperation,
+) error {
+	start := time.Now()
+
+	err := handler(ctx, payload)
+
+	opt := metric.WithAttributes(m.operationAttributes(ctx)...)
+
+	m.operations.Add(ctx, 1, opt)
+	m.operationDuration.Record(ctx, time.Since(start).Seconds(), opt)
+
+	if err != nil {
+		m.operationErrors.Add(ctx, 1, opt)
+	}
+
+	return err
+}
+
+// operationAttributes returns type and name of operation selected from parsed document, if any
+func (m *metrics) operationAttributes(ctx context.Context) (attrs []attribute.KeyValue) {
+	op := wsgraphql.ContextOperationDefinition(ctx)
+	if op == nil {
+		return nil
+	}
+
+	switch op.Operation {
+	case ast.OperationTypeSubscription:
+		attrs = append(attrs, semconv.GraphqlOperationTypeSubscription)
+	case ast.OperationTypeMutation:
+		attrs = append(attrs, semconv.GraphqlOperationTypeMutation)
+	default:
+		attrs = append(attrs, semconv.GraphqlOperationTypeQuery)
+	}
+
+	if op.Name == nil || op.Name.Value == "" {
+		return attrs
+	}
+
+	if _, ok := m.operationNames[op.Name.Value]; ok {
+		return append(attrs, semconv.GraphqlOperationName(op.Name.Value))
+	}
+
+	return append(attrs, semconv.GraphqlOperationName(operationNameOther))
+}
+
+type metricsObserver struct {
+	start       time.Time
+	metrics     *metrics
+	subprotocol attribute.KeyValue
+}
+
+func (observer *metricsObserver) WebsocketConnected(ctx context.Context, subprotocol string) {
+	observer.start = time.Now()
+	observer.subprotocol = SubprotocolKey.String(subprotocol)
+
+	observer.metrics.connectionsActive.Add(ctx, 1, metric.WithAttributes(observer.subprotocol))
+}
+
+func (observer *metricsObserver) WebsocketMessageReceived(
+	ctx context.Context,
+	operation apollows.Operation,
+	size int,
+) {
+	observer.message(ctx, messageDirectionReceived, operation, size)
+}
+
+func (observer *metricsObserver) WebsocketMessageSent(
+	ctx context.Context,
+	operation apollows.Operation,
+	size, _ int,
+) {
+	observer.message(ctx, messageDirectionSent, operation, size)
+}
+
+func (observer *metricsObserver) message(
+	ctx context.Context,
+	direction string,
+	operation apollows.Operation,
+	size int,
+) {
+	opt := metric.WithAttributes(
+		observer.subprotocol,
+		MessageDirectionKey.String(direction),
+		MessageTypeKey.String(string(operation)),
+	)
+
+	observer.metrics.messages.Add(ctx, 1, opt)
+
+	if size > 0 {
+		observer.metrics.messageSize.Record(ctx, int64(size), opt)
+	}
+}
+
+func (observer *metricsObserver) WebsocketClosed(ctx context.Context, code int, _ string) {
+	observer.metrics.connectionsActive.Add(ctx, -1, metric.WithAttributes(observer.subprotocol))
+
+	attrs := []attribute.KeyValue{observer.subprotocol}
+
+	if code != 0 {
+		attrs = append(attrs, CloseCodeKey.Int(code))
+	}
+
+	observer.metrics.connectionDuration.Record(ctx, time.Since(observer.start).Seconds(), metric.WithAttributes(attrs...))
+}
@@ -0,0 +1,203 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+)
+
+// testMeter sums counter increments and counts histogram records by instrument name, keeping counter attributes
+type testMeter struct {
+	noop.Meter
+	values map[string]float64
+	attrs  map[string][]attribute.Set
+	m      sync.Mutex
+}
+
+func (meter *testMeter) add(name string, v float64) {
+	meter.m.Lock()
+	defer meter.m.Unlock()
+
+	meter.values[name] += v
+}
+
+func (meter *testMeter) attributes(name string) []attribute.Set {
+	meter.m.Lock()
+	defer meter.m.Unlock()
+
+	return meter.attrs[name]
+}
+
+func (meter *testMeter) value(name string) float64 {
+	meter.m.Lock()
+	defer meter.m.Unlock()
+
+	return meter.values[name]
+}
+
+type testInt64Counter struct {
+	noop.Int64Counter
+	meter *testMeter
+	name  string
+}
+
+func (c testInt64Counter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	c.meter.add(c.name, float64(incr))
+
+	config := metric.NewAddConfig(opts)
+
+	c.meter.m.Lock()
+	defer c.meter.m.Unlock()
+
+	c.meter.attrs[c.name] = append(c.meter.attrs[c.name], config.Attributes())
+}
+
+type testInt64UpDownCounter struct {
+	noop.Int64UpDownCounter
+	meter *testMeter
+	name  string
+}
+
+func (c testInt64UpDownCounter) Add(_ context.Context, incr int64, _ ...metric.AddOption) {
+	c.meter.add(c.name, float64(incr))
+}
+
+type testInt64Histogram struct {
+	noop.Int64Histogram
+	meter *testMeter
+	name  string
+}
+
+func (h testInt64Histogram) Record(context.Context, int64, ...metric.RecordOption) {
+	h.meter.add(h.name, 1)
+}
+
+type testFloat64Histogram struct {
+	noop.Float64Histogram
+	meter *testMeter
+	name  string
+}
+
+func (h testFloat64Histogram) Record(context.Context, float64, ...metric.RecordOption) {
+	h.meter.add(h.name, 1)
+}
+
+func (meter *testMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return testInt64Counter{meter: meter, name: name}, nil
+}
+
+func (meter *testMeter) Int64UpDownCounter(
+	name string,
+	_ ...metric.Int64UpDownCounterOption,
+) (metric.Int64UpDownCounter, error) {
+	return testInt64UpDownCounter{meter: meter, name: name}, nil
+}
+
+func (meter *testMeter) Int64Histogram(name string, _ ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return testInt64Histogram{meter: meter, name: name}, nil
+}
+
+func (meter *testMeter) Float64Histogram(
+	name string,
+	_ ...metric.Float64HistogramOption,
+) (metric.Float64Histogram, error) {
+	return testFloat64Histogram{meter: meter, name: name}, nil
+}
+
+func TestNewMetricsInterceptors(t *testing.T) {
+	meter := &testMeter{
+		values: make(map[string]float64),
+		attrs:  make(map[string][]attribute.Set),
+	}
+
+	interceptors, err := NewMetricsInterceptors(WithMeter(meter), WithOperationNames("Allowed"))
+
+	assert.NoError(t, err)
+
+	srv := compattest.NewServer(t, gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}), wsgraphql.WithExtraInterceptors(interceptors))
+
+	defer srv.Close()
+
+	conn := compattest.Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.EqualValues(t, 1, meter.value("wsgraphql.connection.active"))
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { unknown }`,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	for i, query := range []string{
+		`query Foo { getFoo }`,
+		`query Allowed { getFoo }`,
+		"# subscription Fake\n{ getFoo }",
+	} {
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			ID:   strconv.Itoa(i + 2),
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: query,
+				},
+			},
+		}))
+
+		for msg.Type != apollows.OperationComplete {
+			assert.NoError(t, conn.ReadJSON(&msg))
+		}
+
+		msg = apollows.Message{}
+	}
+
+	assert.Eventually(t, func() bool {
+		return meter.value("wsgraphql.message.count") == 13 && meter.value("wsgraphql.message.size") == 13
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool {
+		return meter.value("wsgraphql.connection.active") == 0 && meter.value("wsgraphql.connection.duration") == 1
+	}, time.Second, time.Millisecond)
+
+	assert.EqualValues(t, 4, meter.value("wsgraphql.operation.count"))
+	assert.EqualValues(t, 1, meter.value("wsgraphql.operation.errors"))
+	assert.EqualValues(t, 4, meter.value("wsgraphql.operation.duration"))
+
+	// names not in the allow-list are recorded as other, type is taken from the parsed document
+	assert.Equal(t, []attribute.Set{
+		attribute.NewSet(semconv.GraphqlOperationTypeQuery),
+		attribute.NewSet(semconv.GraphqlOperationTypeQuery, semconv.GraphqlOperationName("other")),
+		attribute.NewSet(semconv.GraphqlOperationTypeQuery, semconv.GraphqlOperationName("Allowed")),
+		attribute.NewSet(semconv.GraphqlOperationTypeQuery),
+	}, meter.attributes("wsgraphql.operation.count"))
+}
@@ -0,0 +1,139 @@
+package otelwsgraphql
+
+import (
+	"context"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExtensionTraceID is result extension key of server trace ID, see NewTraceIDResultProcessor
+const ExtensionTraceID = "traceId"
+
+type contextKeyInitPropagationT struct{}
+
+var contextKeyInitPropagation = contextKeyInitPropagationT{}
+
+// initPropagation is trace context and baggage propagated by the client with connection_init payload
+type initPropagation struct {
+	baggage     baggage.Baggage
+	spanContext trace.SpanContext
+}
+
+// WithPropagator sets propagator used to extract trace context and baggage from connection_init payload and operation
+// extensions, otel.GetTextMapPropagator() is used by default
+func WithPropagator(propagator propagation.TextMapPropagator) OperationOption {
+	return optionFunc(func(c *operationConfig) {
+		c.propagator = propagator
+	})
+}
+
+// NewInitInterceptor returns new wsgraphql init interceptor, extracting trace context and baggage from connection_init
+// payload, e.g. traceparent, tracestate and baggage fields, to be used as parent of operation spans on the connection
+func NewInitInterceptor(options ...OperationOption) wsgraphql.InterceptorInit {
+	return newOperationConfig(options).interceptInit
+}
+
+// extractInit stores trace context and baggage propagated with connection_init payload in the request context
+func (c *operationConfig) extractInit(ctx context.Context, init apollows.PayloadInit) {
+	extracted := c.textMapPropagator().Extract(context.Background(), mapCarrier(init))
+
+	prop := initPropagation{
+		baggage:     baggage.FromContext(extracted),
+		spanContext: trace.SpanContextFromContext(extracted),
+	}
+
+	if prop.spanContext.IsValid() || prop.baggage.Len() > 0 {
+		wsgraphql.RequestContext(ctx).Set(contextKeyInitPropagation, prop)
+	}
+}
+
+// propagatedContext returns context with trace context and baggage propagated by the client with operation extensions
+// or connection_init payload, in that order of precedence, and links to the connection span if it was replaced
+func (c *operationConfig) propagatedContext(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+) (context.Context, []trace.Link) {
+	connection := trace.SpanContextFromContext(ctx)
+
+	if prop, ok := ctx.Value(contextKeyInitPropagation).(initPropagation); ok {
+		if prop.spanContext.IsValid() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, prop.spanContext)
+		}
+
+		if prop.baggage.Len() > 0 {
+			ctx = baggage.ContextWithBaggage(ctx, prop.baggage)
+		}
+	}
+
+	ctx = c.textMapPropagator().Extract(ctx, mapCarrier(payload.Extensions))
+
+	if !connection.IsValid() || trace.SpanContextFromContext(ctx).Equal(connection) {
+		return ctx, nil
+	}
+
+	return ctx, []trace.Link{
+		{
+			SpanContext: connection,
+		},
+	}
+}
+
+func (c *operationConfig) textMapPropagator() propagation.TextMapPropagator {
+	if c.propagator != nil {
+		return c.propagator
+	}
+
+	return otel.GetTextMapPropagator()
+}
+
+// NewTraceIDResultProcessor returns result processor setting ExtensionTraceID result extension to the trace ID of
+// operation span, to be used with wsgraphql.WithResultProcessor. Provided processor, if any, is called first.
+func NewTraceIDResultProcessor(processor wsgraphql.ResultProcessor) wsgraphql.ResultProcessor {
+	return func(ctx context.Context, payload *apollows.PayloadOperation, result *graphql.Result) *graphql.Result {
+		if processor != nil {
+			result = processor(ctx, payload, result)
+		}
+
+		spanContext := trace.SpanContextFromContext(ctx)
+		if !spanContext.HasTraceID() {
+			return result
+		}
+
+		if result.Extensions == nil {
+			result.Extensions = make(map[string]interface{})
+		}
+
+		result.Extensions[ExtensionTraceID] = spanContext.TraceID().String()
+
+		return result
+	}
+}
+
+// mapCarrier adapts connection_init payload or operation extensions to propagation.TextMapCarrier
+type mapCarrier map[string]interface{}
+
+func (carrier mapCarrier) Get(key string) string {
+	s, _ := carrier[key].(string)
+
+	return s
+}
+
+func (carrier mapCarrier) Set(key, value string) {
+	carrier[key] = value
+}
+
+func (carrier mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+
+	for k := range carrier {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,140 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagation(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	tracer := &testTracer{}
+
+	connection := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	type observed struct {
+		traceID string
+		member  string
+	}
+
+	results := make(chan observed, 2)
+
+	srv := compattest.NewServer(t, gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}), wsgraphql.WithExtraInterceptors(wsgraphql.Interceptors{
+		HTTPRequest: func(
+			ctx context.Context,
+			w http.ResponseWriter,
+			r *http.Request,
+			handler wsgraphql.HandlerHTTPRequest,
+		) error {
+			return handler(trace.ContextWithSpanContext(ctx, connection), w, r)
+		},
+		Init:      NewInitInterceptor(WithPropagator(propagator)),
+		Operation: NewOperationInterceptor(WithTracer(tracer), WithPropagator(propagator)),
+		OperationExecute: func(
+			ctx context.Context,
+			payload *apollows.PayloadOperation,
+			handler wsgraphql.HandlerOperationExecute,
+		) (chan *graphql.Result, error) {
+			results <- observed{
+				traceID: trace.SpanContextFromContext(ctx).TraceID().String(),
+				member:  baggage.FromContext(ctx).Member("tenant").Value(),
+			}
+
+			return handler(ctx, payload)
+		},
+	}), wsgraphql.WithResultProcessor(NewTraceIDResultProcessor(nil)))
+
+	defer srv.Close()
+
+	conn := compattest.Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	initTraceID := "0af7651916cd43dd8448eb211c80319c"
+	operationTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+		Payload: apollows.Data{
+			Value: apollows.PayloadInit{
+				"traceparent": "00-" + initTraceID + "-b7ad6b7169203331-01",
+				"baggage":     "tenant=foo",
+			},
+		},
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+			},
+		},
+	}))
+
+	assert.Equal(t, observed{traceID: initTraceID, member: "foo"}, <-results)
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	var result struct {
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+
+	assert.NoError(t, json.Unmarshal(msg.Payload.RawMessage, &result))
+	assert.Equal(t, initTraceID, result.Extensions[ExtensionTraceID])
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "2",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+				Extensions: map[string]interface{}{
+					"traceparent": "00-" + operationTraceID + "-00f067aa0ba902b7-01",
+				},
+			},
+		},
+	}))
+
+	assert.Equal(t, observed{traceID: operationTraceID, member: "foo"}, <-results)
+
+	tracer.m.Lock()
+	defer tracer.m.Unlock()
+
+	assert.Len(t, tracer.links, 2)
+
+	for _, link := range tracer.links {
+		assert.True(t, link.SpanContext.Equal(connection))
+	}
+}
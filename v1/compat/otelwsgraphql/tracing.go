@@ -0,0 +1,369 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	spanNameConnection = "gql.connection"
+	spanNameInit       = "gql.init"
+	spanNameParse      = "gql.parse"
+	spanNameValidate   = "gql.validate"
+	eventNameResult    = "gql.result"
+)
+
+var (
+	// CloseReasonKey is attribute key of websocket close reason sent by the server
+	CloseReasonKey = attribute.Key("websocket.close_reason")
+	// ErrorLocationsKey is attribute key of graphql error locations in the document, as line:column
+	ErrorLocationsKey = attribute.Key("graphql.error.locations")
+	// ErrorPathKey is attribute key of graphql error path
+	ErrorPathKey = attribute.Key("graphql.error.path")
+	// ResultErrorsKey is attribute key of number of errors in operation result
+	ResultErrorsKey = attribute.Key("graphql.result.errors")
+	// ResultSizeKey is attribute key of encoded size of websocket message carrying operation result, in bytes
+	ResultSizeKey = attribute.Key("graphql.result.size")
+)
+
+type contextKeyTracingConfigT struct{}
+
+var contextKeyTracingConfig = contextKeyTracingConfigT{}
+
+type contextKeyResultErrorsT struct{}
+
+var contextKeyResultErrors = contextKeyResultErrorsT{}
+
+// NewInterceptors returns interceptors tracing websocket connections, connection initialization, operations, their
+// parsing and validation, and results, to be used with wsgraphql.WithExtraInterceptors. All interceptors share
+// provided options. Parsing and validation spans are started by extension returned by NewExtension, which should be
+// provided with wsgraphql.WithExtensions.
+func NewInterceptors(options ...OperationOption) wsgraphql.Interceptors {
+	c := newOperationConfig(options)
+
+	return wsgraphql.Interceptors{
+		HTTPRequest:      c.interceptHTTPRequest,
+		Init:             c.interceptInit,
+		Operation:        c.interceptOperation,
+		OperationParse:   c.interceptOperationParse,
+		OperationExecute: c.interceptOperationExecute,
+	}
+}
+
+// NewExtension returns graphql extension tracing operation parsing and validation as child spans of the operation
+// span, to be used with wsgraphql.WithExtensions. Spans are started with configuration of interceptors returned by
+// NewInterceptors, only for operations passed through them.
+func NewExtension() graphql.Extension {
+	return tracingExtension{}
+}
+
+// interceptHTTPRequest starts span for websocket connection, ended once connection is closed
+func (c *operationConfig) interceptHTTPRequest(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	handler wsgraphql.HandlerHTTPRequest,
+) error {
+	if r.Header.Get("upgrade") == "" {
+		return handler(ctx, w, r)
+	}
+
+	ctx, span := c.resolveTracer(ctx).Start(ctx, spanNameConnection, c.startSpanOptions...)
+
+	observer := &tracingObserver{
+		span: span,
+	}
+
+	wsgraphql.ObserveWebsocket(ctx, observer)
+
+	err := handler(ctx, w, r)
+
+	// connection was not established, otherwise span is ended by observer
+	if !observer.connected {
+		endSpan(span, err)
+	}
+
+	return err
+}
+
+// interceptInit extracts propagated trace context and starts span for websocket connection initialization
+func (c *operationConfig) interceptInit(
+	ctx context.Context,
+	init apollows.PayloadInit,
+	handler wsgraphql.HandlerInit,
+) error {
+	c.extractInit(ctx, init)
+
+	if wsgraphql.ContextWebsocketConnection(ctx) == nil {
+		return handler(ctx, init)
+	}
+
+	ctx, span := c.resolveTracer(ctx).Start(ctx, spanNameInit, trace.WithSpanKind(trace.SpanKindInternal))
+
+	err := handler(ctx, init)
+
+	endSpan(span, err)
+
+	return err
+}
+
+// interceptOperationParse provides configuration to the extension tracing parsing and validation
+func (c *operationConfig) interceptOperationParse(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperationParse,
+) error {
+	return handler(context.WithValue(ctx, contextKeyTracingConfig, c), payload)
+}
+
+// interceptOperationExecute adds event to operation span for each of operation results; events of websocket
+// operations are added by the connection observer once result is written, with its encoded size
+func (*operationConfig) interceptOperationExecute(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperationExecute,
+) (chan *graphql.Result, error) {
+	cres, err := handler(ctx, payload)
+
+	span := trace.SpanFromContext(ctx)
+	if err != nil || !span.IsRecording() {
+		return cres, err
+	}
+
+	var pending *resultErrors
+
+	if wsgraphql.ContextWebsocketConnection(ctx) != nil {
+		pending = &resultErrors{}
+
+		wsgraphql.OperationContext(ctx).Set(contextKeyResultErrors, pending)
+	}
+
+	out := make(chan *graphql.Result)
+
+	go func() {
+		defer close(out)
+
+		for {
+			var (
+				result *graphql.Result
+				ok     bool
+			)
+
+			select {
+			case <-ctx.Done():
+				return
+			case result, ok = <-cres:
+				if !ok {
+					return
+				}
+			}
+
+			if pending != nil {
+				pending.push(len(result.Errors))
+			} else {
+				span.AddEvent(eventNameResult, trace.WithAttributes(
+					ResultErrorsKey.Int(len(result.Errors)),
+				))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- result:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func errorAttributes(e gqlerrors.FormattedError) (attrs []attribute.KeyValue) {
+	if len(e.Locations) > 0 {
+		locations := make([]string, 0, len(e.Locations))
+
+		for _, l := range e.Locations {
+			locations = append(locations, strconv.Itoa(l.Line)+":"+strconv.Itoa(l.Column))
+		}
+
+		attrs = append(attrs, ErrorLocationsKey.StringSlice(locations))
+	}
+
+	if len(e.Path) > 0 {
+		path := make([]string, 0, len(e.Path))
+
+		for _, p := range e.Path {
+			path = append(path, fmt.Sprint(p))
+		}
+
+		attrs = append(attrs, ErrorPathKey.String(strings.Join(path, ".")))
+	}
+
+	return
+}
+
+// resultErrors holds errors count of operation results not yet written to websocket connection, in order
+type resultErrors struct {
+	counts []int
+	m      sync.Mutex
+}
+
+func (r *resultErrors) push(count int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.counts = append(r.counts, count)
+}
+
+func (r *resultErrors) pop() (count int, ok bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if len(r.counts) == 0 {
+		return 0, false
+	}
+
+	count, r.counts = r.counts[0], r.counts[1:]
+
+	return count, true
+}
+
+type tracingExtension struct{}
+
+func (tracingExtension) Init(ctx context.Context, _ *graphql.Params) context.Context {
+	return ctx
+}
+
+func (tracingExtension) Name() string {
+	return instrumentationName
+}
+
+// ParseDidStart starts span for operation parsing, keeping the context, so following spans are not its children
+func (tracingExtension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	c, ok := ctx.Value(contextKeyTracingConfig).(*operationConfig)
+	if !ok {
+		return ctx, func(error) {}
+	}
+
+	_, span := c.resolveTracer(ctx).Start(ctx, spanNameParse, trace.WithSpanKind(trace.SpanKindInternal))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err, trace.WithAttributes(errorAttributes(gqlerrors.FormatError(err))...))
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+
+		span.End()
+	}
+}
+
+// ValidationDidStart starts span for operation validation, recording each of validation errors
+func (tracingExtension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	c, ok := ctx.Value(contextKeyTracingConfig).(*operationConfig)
+	if !ok {
+		return ctx, func([]gqlerrors.FormattedError) {}
+	}
+
+	_, span := c.resolveTracer(ctx).Start(ctx, spanNameValidate, trace.WithSpanKind(trace.SpanKindInternal))
+
+	return ctx, func(errs []gqlerrors.FormattedError) {
+		for _, e := range errs {
+			span.RecordError(e, trace.WithAttributes(errorAttributes(e)...))
+		}
+
+		if len(errs) > 0 {
+			span.SetStatus(codes.Error, errs[0].Message)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+
+		span.End()
+	}
+}
+
+func (tracingExtension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(*graphql.Result) {}
+}
+
+func (tracingExtension) ResolveFieldDidStart(
+	ctx context.Context,
+	_ *graphql.ResolveInfo,
+) (context.Context, graphql.ResolveFieldFinishFunc) {
+	return ctx, func(interface{}, error) {}
+}
+
+func (tracingExtension) HasResult() bool {
+	return false
+}
+
+func (tracingExtension) GetResult(context.Context) interface{} {
+	return nil
+}
+
+type tracingObserver struct {
+	span      trace.Span
+	connected bool
+}
+
+func (observer *tracingObserver) WebsocketConnected(_ context.Context, subprotocol string) {
+	observer.connected = true
+
+	observer.span.SetAttributes(SubprotocolKey.String(subprotocol))
+}
+
+func (*tracingObserver) WebsocketMessageReceived(context.Context, apollows.Operation, int) {
+}
+
+// WebsocketMessageSent adds event to operation span for each of written operation results
+func (*tracingObserver) WebsocketMessageSent(ctx context.Context, operation apollows.Operation, size, _ int) {
+	switch operation {
+	case apollows.OperationData, apollows.OperationNext:
+	default:
+		return
+	}
+
+	pending, ok := ctx.Value(contextKeyResultErrors).(*resultErrors)
+	if !ok {
+		return
+	}
+
+	var attrs []attribute.KeyValue
+
+	if size > 0 {
+		attrs = append(attrs, ResultSizeKey.Int(size))
+	}
+
+	if count, ok := pending.pop(); ok {
+		attrs = append(attrs, ResultErrorsKey.Int(count))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent(eventNameResult, trace.WithAttributes(attrs...))
+}
+
+func (observer *tracingObserver) WebsocketClosed(_ context.Context, code int, reason string) {
+	if code != 0 {
+		observer.span.SetAttributes(CloseCodeKey.Int(code), CloseReasonKey.String(reason))
+	}
+
+	switch code {
+	case 0, int(apollows.EventCloseNormal):
+		observer.span.SetStatus(codes.Ok, "")
+	default:
+		observer.span.SetStatus(codes.Error, reason)
+	}
+
+	observer.span.End()
+}
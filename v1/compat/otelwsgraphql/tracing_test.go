@@ -0,0 +1,280 @@
+package otelwsgraphql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testTracer records started spans and their links
+type testTracer struct {
+	trace.Tracer
+	spans []*testSpan
+	links []trace.Link
+	m     sync.Mutex
+}
+
+func (tracer *testTracer) Start(
+	ctx context.Context,
+	name string,
+	opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+
+	// noop span carries span context of the parent, if any
+	_, noop := trace.NewNoopTracerProvider().Tracer("").Start(ctx, name, opts...)
+
+	span := &testSpan{
+		Span:   noop,
+		tracer: tracer,
+		parent: trace.SpanFromContext(ctx),
+		name:   name,
+		attrs:  make(map[attribute.Key]attribute.Value),
+	}
+
+	tracer.m.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.links = append(tracer.links, config.Links()...)
+	tracer.m.Unlock()
+
+	span.SetAttributes(config.Attributes()...)
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// spansNamed returns started spans with given name
+func (tracer *testTracer) spansNamed(name string) (spans []*testSpan) {
+	tracer.m.Lock()
+	defer tracer.m.Unlock()
+
+	for _, span := range tracer.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+
+	return
+}
+
+type testSpan struct {
+	trace.Span
+	tracer     *testTracer
+	parent     trace.Span
+	attrs      map[attribute.Key]attribute.Value
+	name       string
+	events     []string
+	eventAttrs []map[attribute.Key]attribute.Value
+	errors     int
+	status     codes.Code
+	ended      bool
+}
+
+func (span *testSpan) IsRecording() bool {
+	return true
+}
+
+func (span *testSpan) SetName(name string) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	span.name = name
+}
+
+func (span *testSpan) SetAttributes(kv ...attribute.KeyValue) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	for _, attr := range kv {
+		span.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (span *testSpan) AddEvent(name string, opts ...trace.EventOption) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	attrs := make(map[attribute.Key]attribute.Value)
+
+	config := trace.NewEventConfig(opts...)
+
+	for _, attr := range config.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+
+	span.events = append(span.events, name)
+	span.eventAttrs = append(span.eventAttrs, attrs)
+}
+
+func (span *testSpan) RecordError(error, ...trace.EventOption) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	span.errors++
+}
+
+func (span *testSpan) SetStatus(code codes.Code, _ string) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	span.status = code
+}
+
+func (span *testSpan) End(...trace.SpanEndOption) {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	span.ended = true
+}
+
+// snapshot returns copy of span state
+func (span *testSpan) snapshot() testSpan {
+	span.tracer.m.Lock()
+	defer span.tracer.m.Unlock()
+
+	return *span
+}
+
+func TestNewInterceptors(t *testing.T) {
+	tracer := &testTracer{}
+
+	srv := compattest.NewServer(t, gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}), wsgraphql.WithExtraInterceptors(NewInterceptors(WithTracer(tracer))),
+		wsgraphql.WithExtensions(NewExtension()),
+	)
+
+	defer srv.Close()
+
+	conn := compattest.Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	}))
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+	}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "2",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { unknown }`,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "3",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query {`,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	assert.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool {
+		spans := tracer.spansNamed(spanNameConnection)
+
+		return len(spans) == 1 && spans[0].snapshot().ended
+	}, time.Second, time.Millisecond)
+
+	connection := tracer.spansNamed(spanNameConnection)[0].snapshot()
+
+	assert.Equal(t, apollows.WebsocketSubprotocolGraphqlTransportWS.String(), connection.attrs[SubprotocolKey].AsString())
+
+	if assert.Len(t, tracer.spansNamed(spanNameInit), 1) {
+		assert.True(t, tracer.spansNamed(spanNameInit)[0].snapshot().ended)
+	}
+
+	subscription := tracer.spansNamed("gql.subscription")
+
+	if assert.Len(t, subscription, 1) {
+		snapshot := subscription[0].snapshot()
+
+		assert.Equal(t, []string{eventNameResult, eventNameResult, eventNameResult}, snapshot.events)
+
+		for _, attrs := range snapshot.eventAttrs {
+			assert.Greater(t, attrs[ResultSizeKey].AsInt64(), int64(0))
+			assert.Equal(t, int64(0), attrs[ResultErrorsKey].AsInt64())
+			assert.Contains(t, attrs, ResultErrorsKey)
+		}
+	}
+
+	query := tracer.spansNamed("gql.query")
+
+	if !assert.Len(t, query, 2) {
+		return
+	}
+
+	assert.Equal(t, codes.Error, query[0].snapshot().status)
+	assert.Equal(t, codes.Error, query[1].snapshot().status)
+
+	parse := tracer.spansNamed(spanNameParse)
+
+	if assert.Len(t, parse, 3) {
+		assert.Equal(t, codes.Ok, parse[0].snapshot().status)
+		assert.Equal(t, codes.Ok, parse[1].snapshot().status)
+
+		failed := parse[2].snapshot()
+
+		assert.True(t, failed.ended)
+		assert.Equal(t, codes.Error, failed.status)
+		assert.Equal(t, 1, failed.errors)
+		assert.Same(t, query[1], failed.parent)
+	}
+
+	validate := tracer.spansNamed(spanNameValidate)
+
+	if assert.Len(t, validate, 2) {
+		assert.Equal(t, codes.Ok, validate[0].snapshot().status)
+		assert.Same(t, subscription[0], validate[0].snapshot().parent)
+
+		failed := validate[1].snapshot()
+
+		assert.True(t, failed.ended)
+		assert.Equal(t, codes.Error, failed.status)
+		assert.Equal(t, 1, failed.errors)
+		assert.Same(t, query[0], failed.parent)
+	}
+}
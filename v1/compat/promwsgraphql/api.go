@@ -0,0 +1,331 @@
+// Package promwsgraphql provides prometheus metrics for wsgraphql
+package promwsgraphql
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// operationTypeUnknown is type label of operations rejected before operation was selected from parsed document
+	operationTypeUnknown = "unknown"
+	// operationNameOther is name label of named operations not in the allow-list
+	operationNameOther = "other"
+)
+
+// Option provides customizations for the collector
+type Option interface {
+	apply(*config)
+}
+
+// WithNamespace sets namespace of the metrics, "wsgraphql" by default
+func WithNamespace(namespace string) Option {
+	return optionFunc(func(c *config) {
+		c.namespace = namespace
+	})
+}
+
+// WithConstLabels sets labels added to all metrics
+func WithConstLabels(labels prometheus.Labels) Option {
+	return optionFunc(func(c *config) {
+		c.constLabels = labels
+	})
+}
+
+// WithDurationBuckets sets buckets of connection duration and operation latency histograms, in seconds
+func WithDurationBuckets(buckets []float64) Option {
+	return optionFunc(func(c *config) {
+		c.durationBuckets = buckets
+	})
+}
+
+// WithOperationNames sets allow-list of operation names reported as name label, other named operations are reported
+// as "other", keeping label cardinality bounded; by default all named operations are reported as "other"
+func WithOperationNames(names ...string) Option {
+	return optionFunc(func(c *config) {
+		c.operationNames = make(map[string]struct{}, len(names))
+
+		for _, name := range names {
+			c.operationNames[name] = struct{}{}
+		}
+	})
+}
+
+// Collector of wsgraphql metrics, should be registered with prometheus.Registerer and plugged into the server with
+// wsgraphql.WithExtraInterceptors(collector.Interceptors())
+type Collector struct {
+	connectionsActive   *prometheus.GaugeVec
+	connectionDuration  *prometheus.HistogramVec
+	closeCodes          *prometheus.CounterVec
+	outgoingQueueDepth  *prometheus.HistogramVec
+	operationsStarted   *prometheus.CounterVec
+	operationsCompleted *prometheus.CounterVec
+	operationsFailed    *prometheus.CounterVec
+	operationDuration   *prometheus.HistogramVec
+	subscriptionEvents  *prometheus.CounterVec
+	operationNames      map[string]struct{}
+}
+
+// NewCollector returns new Collector
+func NewCollector(options ...Option) *Collector {
+	c := config{
+		namespace:       "wsgraphql",
+		durationBuckets: prometheus.DefBuckets,
+	}
+
+	for _, o := range options {
+		o.apply(&c)
+	}
+
+	return &Collector{
+		connectionsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   c.namespace,
+			Name:        "websocket_connections_active",
+			Help:        "Number of active websocket connections.",
+			ConstLabels: c.constLabels,
+		}, []string{"subprotocol"}),
+		connectionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Name:        "websocket_connection_duration_seconds",
+			Help:        "Duration of websocket connections.",
+			ConstLabels: c.constLabels,
+			Buckets:     c.durationBuckets,
+		}, []string{"subprotocol"}),
+		closeCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "websocket_close_codes_total",
+			Help:        "Number of websocket connections closed by the server, by close code.",
+			ConstLabels: c.constLabels,
+		}, []string{"subprotocol", "code"}),
+		outgoingQueueDepth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Name:        "websocket_outgoing_queue_depth",
+			Help:        "Number of messages waiting to be written to websocket connection.",
+			ConstLabels: c.constLabels,
+			Buckets:     []float64{0, 1, 2, 4, 8, 16, 32},
+		}, []string{"subprotocol"}),
+		operationsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "operations_started_total",
+			Help:        "Number of started graphql operations.",
+			ConstLabels: c.constLabels,
+		}, []string{"type", "name"}),
+		operationsCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "operations_completed_total",
+			Help:        "Number of graphql operations completed without errors.",
+			ConstLabels: c.constLabels,
+		}, []string{"type", "name"}),
+		operationsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "operations_failed_total",
+			Help:        "Number of graphql operations completed with errors.",
+			ConstLabels: c.constLabels,
+		}, []string{"type", "name"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Name:        "operation_duration_seconds",
+			Help:        "Latency of graphql operations, including subscriptions lifetime.",
+			ConstLabels: c.constLabels,
+			Buckets:     c.durationBuckets,
+		}, []string{"type", "name"}),
+		subscriptionEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "subscription_events_sent_total",
+			Help:        "Number of subscription events sent over websocket connections.",
+			ConstLabels: c.constLabels,
+		}, []string{"name"}),
+		operationNames: c.operationNames,
+	}
+}
+
+func (collector *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		collector.connectionsActive,
+		collector.connectionDuration,
+		collector.closeCodes,
+		collector.outgoingQueueDepth,
+		collector.operationsStarted,
+		collector.operationsCompleted,
+		collector.operationsFailed,
+		collector.operationDuration,
+		collector.subscriptionEvents,
+	}
+}
+
+// Describe implementation
+func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range collector.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implementation
+func (collector *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range collector.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Interceptors returns interceptors reporting metrics, to be used with wsgraphql.WithExtraInterceptors
+func (collector *Collector) Interceptors() wsgraphql.Interceptors {
+	return wsgraphql.Interceptors{
+		HTTPRequest:    collector.interceptHTTPRequest,
+		Operation:      collector.interceptOperation,
+		OperationParse: collector.interceptOperationParse,
+	}
+}
+
+func (collector *Collector) interceptHTTPRequest(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	handler wsgraphql.HandlerHTTPRequest,
+) error {
+	wsgraphql.ObserveWebsocket(ctx, &connectionObserver{
+		collector: collector,
+	})
+
+	return handler(ctx, w, r)
+}
+
+func (collector *Collector) interceptOperation(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperation,
+) error {
+	start := time.Now()
+
+	err := handler(ctx, payload)
+
+	labels, ok := ctx.Value(contextKeyOperationLabels{}).(prometheus.Labels)
+	if !ok {
+		// operation was rejected before parsing
+		labels = collector.operationLabels(ctx)
+
+		collector.operationsStarted.With(labels).Inc()
+	}
+
+	collector.operationDuration.With(labels).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		collector.operationsFailed.With(labels).Inc()
+	} else {
+		collector.operationsCompleted.With(labels).Inc()
+	}
+
+	return err
+}
+
+// interceptOperationParse counts operation as started once its type and name are known from parsed document
+func (collector *Collector) interceptOperationParse(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperationParse,
+) error {
+	err := handler(ctx, payload)
+
+	labels := collector.operationLabels(ctx)
+
+	wsgraphql.OperationContext(ctx).Set(contextKeyOperationLabels{}, labels)
+
+	collector.operationsStarted.With(labels).Inc()
+
+	return err
+}
+
+type contextKeyOperationLabels struct{}
+
+// operationLabels determines operation type and name from operation selected from parsed document
+func (collector *Collector) operationLabels(ctx context.Context) prometheus.Labels {
+	op := wsgraphql.ContextOperationDefinition(ctx)
+	if op == nil {
+		return prometheus.Labels{
+			"type": operationTypeUnknown,
+			"name": "",
+		}
+	}
+
+	var name string
+
+	if op.Name != nil && op.Name.Value != "" {
+		name = operationNameOther
+
+		if _, ok := collector.operationNames[op.Name.Value]; ok {
+			name = op.Name.Value
+		}
+	}
+
+	return prometheus.Labels{
+		"type": op.Operation,
+		"name": name,
+	}
+}
+
+type connectionObserver struct {
+	start       time.Time
+	collector   *Collector
+	subprotocol string
+}
+
+func (observer *connectionObserver) WebsocketConnected(_ context.Context, subprotocol string) {
+	observer.start = time.Now()
+	observer.subprotocol = subprotocol
+
+	observer.collector.connectionsActive.WithLabelValues(subprotocol).Inc()
+}
+
+func (observer *connectionObserver) WebsocketMessageReceived(context.Context, apollows.Operation, int) {
+}
+
+func (observer *connectionObserver) WebsocketMessageSent(
+	ctx context.Context,
+	operation apollows.Operation,
+	_, queued int,
+) {
+	observer.collector.outgoingQueueDepth.WithLabelValues(observer.subprotocol).Observe(float64(queued))
+
+	switch operation {
+	case apollows.OperationData, apollows.OperationNext:
+	default:
+		return
+	}
+
+	if !wsgraphql.ContextSubscription(ctx) {
+		return
+	}
+
+	labels, _ := ctx.Value(contextKeyOperationLabels{}).(prometheus.Labels)
+
+	observer.collector.subscriptionEvents.WithLabelValues(labels["name"]).Inc()
+}
+
+func (observer *connectionObserver) WebsocketClosed(_ context.Context, code int, _ string) {
+	observer.collector.connectionsActive.WithLabelValues(observer.subprotocol).Dec()
+	observer.collector.connectionDuration.WithLabelValues(observer.subprotocol).Observe(
+		time.Since(observer.start).Seconds(),
+	)
+
+	if code != 0 {
+		observer.collector.closeCodes.WithLabelValues(observer.subprotocol, strconv.Itoa(code)).Inc()
+	}
+}
+
+type config struct {
+	constLabels     prometheus.Labels
+	namespace       string
+	operationNames  map[string]struct{}
+	durationBuckets []float64
+}
+
+type optionFunc func(c *config)
+
+func (o optionFunc) apply(c *config) {
+	o(c)
+}
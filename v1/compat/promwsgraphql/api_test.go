@@ -0,0 +1,193 @@
+package promwsgraphql
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector(WithOperationNames("Updates"))
+
+	registry := prometheus.NewRegistry()
+
+	assert.NoError(t, registry.Register(collector))
+
+	srv := compattest.NewServer(t, gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}), wsgraphql.WithExtraInterceptors(collector.Interceptors()))
+
+	defer srv.Close()
+
+	protocol := apollows.WebsocketSubprotocolGraphqlTransportWS
+	conn := compattest.Dial(t, srv, protocol)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.connectionsActive.WithLabelValues(protocol.String())))
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription Updates { fooUpdates }`,
+			},
+		},
+	}))
+
+	for {
+		msg = apollows.Message{}
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+
+		if msg.Type == apollows.OperationComplete {
+			break
+		}
+	}
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "2",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { unknown }`,
+			},
+		},
+	}))
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "3",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `# subscription Fake
+				query Foo { getFoo }`,
+			},
+		},
+	}))
+
+	for {
+		msg = apollows.Message{}
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+
+		if msg.Type == apollows.OperationComplete {
+			break
+		}
+	}
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "4",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query:         `query Foo { getFoo }`,
+				OperationName: "Bar",
+			},
+		},
+	}))
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	subscription := prometheus.Labels{"type": "subscription", "name": "Updates"}
+	query := prometheus.Labels{"type": "query", "name": ""}
+	other := prometheus.Labels{"type": "query", "name": "other"}
+	unknown := prometheus.Labels{"type": "unknown", "name": ""}
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(collector.operationsFailed.With(unknown)) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsStarted.With(unknown)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsFailed.With(query)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsStarted.With(other)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsCompleted.With(other)))
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsStarted.With(subscription)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsCompleted.With(subscription)))
+	assert.EqualValues(t, 3, testutil.ToFloat64(collector.subscriptionEvents.WithLabelValues("Updates")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operationsStarted.With(query)))
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	_, _, err := conn.ReadMessage()
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventTooManyInitializationRequests)), "%v", err)
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(collector.connectionsActive.WithLabelValues(protocol.String())) == 0
+	}, time.Second, time.Millisecond)
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.closeCodes.WithLabelValues(
+		protocol.String(),
+		"4429",
+	)))
+	assert.EqualValues(t, 1, testutil.CollectAndCount(collector.connectionDuration))
+	assert.EqualValues(t, 1, testutil.CollectAndCount(collector.outgoingQueueDepth))
+
+	count, err := testutil.GatherAndCount(registry)
+
+	assert.NoError(t, err)
+	assert.Greater(t, count, 0)
+}
+
+func TestCollectorOutgoingQueueDepth(t *testing.T) {
+	collector := NewCollector()
+
+	observer := &connectionObserver{
+		collector: collector,
+	}
+
+	observer.WebsocketConnected(context.Background(), "graphql-transport-ws")
+	observer.WebsocketMessageSent(context.Background(), apollows.OperationNext, 16, 0)
+	observer.WebsocketMessageSent(context.Background(), apollows.OperationNext, 16, 3)
+
+	expected := `
+# HELP wsgraphql_websocket_outgoing_queue_depth Number of messages waiting to be written to websocket connection.
+# TYPE wsgraphql_websocket_outgoing_queue_depth histogram
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="0"} 1
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="1"} 1
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="2"} 1
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="4"} 2
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="8"} 2
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="16"} 2
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="32"} 2
+wsgraphql_websocket_outgoing_queue_depth_bucket{subprotocol="graphql-transport-ws",le="+Inf"} 2
+wsgraphql_websocket_outgoing_queue_depth_sum{subprotocol="graphql-transport-ws"} 3
+wsgraphql_websocket_outgoing_queue_depth_count{subprotocol="graphql-transport-ws"} 2
+`
+
+	assert.NoError(t, testutil.CollectAndCompare(collector.outgoingQueueDepth, strings.NewReader(expected)))
+}
@@ -0,0 +1,379 @@
+//go:build go1.21
+// +build go1.21
+
+package slogwsgraphql
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// RedactedValue replaces values of redacted variables
+const RedactedValue = "[REDACTED]"
+
+// UploadValue replaces uploaded files in logged variables
+const UploadValue = "[UPLOAD]"
+
+// DefaultRedactedVariables lists names of variables redacted by default, matched case-insensitively at any depth
+var DefaultRedactedVariables = []string{"password", "secret", "token", "authorization"}
+
+type contextKeyLoggerT struct{}
+
+var contextKeyLogger = contextKeyLoggerT{}
+
+// Option provides customizations for the interceptors
+type Option interface {
+	apply(*config)
+}
+
+// VariablesRedactor returns operation variables as they should be logged, uploaded files are replaced with
+// UploadValue beforehand
+type VariablesRedactor func(ctx context.Context, variables map[string]interface{}) map[string]interface{}
+
+// WithLogger sets logger, slog.Default() is used by default
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(c *config) {
+		c.logger = logger
+	})
+}
+
+// WithLevel sets level of connection and operation records, slog.LevelInfo by default. Failures are logged with
+// slog.LevelWarn, subscription events with slog.LevelDebug.
+func WithLevel(level slog.Level) Option {
+	return optionFunc(func(c *config) {
+		c.level = level
+	})
+}
+
+// WithRedactedVariables sets names of variables to be redacted, matched case-insensitively at any depth,
+// DefaultRedactedVariables by default
+func WithRedactedVariables(names ...string) Option {
+	return optionFunc(func(c *config) {
+		c.redacted = make(map[string]struct{}, len(names))
+
+		for _, name := range names {
+			c.redacted[strings.ToLower(name)] = struct{}{}
+		}
+	})
+}
+
+// WithVariablesRedactor provides custom variables redactor, replacing redaction by name
+func WithVariablesRedactor(redactor VariablesRedactor) Option {
+	return optionFunc(func(c *config) {
+		c.redactor = redactor
+	})
+}
+
+// WithEventSampling logs only each n-th subscription event of an operation, starting with the first one, all events
+// are logged by default
+func WithEventSampling(n int) Option {
+	return optionFunc(func(c *config) {
+		c.eventSampling = n
+	})
+}
+
+// NewInterceptors returns interceptors logging websocket connections, their initialization, operations and
+// subscription events, to be used with wsgraphql.WithExtraInterceptors. Loggers carrying connection and operation
+// attributes are available to handlers with ContextLogger.
+func NewInterceptors(options ...Option) wsgraphql.Interceptors {
+	c := &config{
+		logger:        slog.Default(),
+		level:         slog.LevelInfo,
+		eventSampling: 1,
+	}
+
+	WithRedactedVariables(DefaultRedactedVariables...).apply(c)
+
+	for _, o := range options {
+		o.apply(c)
+	}
+
+	if c.redactor == nil {
+		c.redactor = c.redactVariables
+	}
+
+	if c.eventSampling < 1 {
+		c.eventSampling = 1
+	}
+
+	return wsgraphql.Interceptors{
+		HTTPRequest:    c.interceptHTTPRequest,
+		Init:           c.interceptInit,
+		Operation:      c.interceptOperation,
+		OperationParse: c.interceptOperationParse,
+	}
+}
+
+// ContextLogger returns logger of the operation or the connection stored in the context by interceptors, or
+// slog.Default() if there is none
+func ContextLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKeyLogger).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+func (c *config) interceptHTTPRequest(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	handler wsgraphql.HandlerHTTPRequest,
+) error {
+	logger := c.logger.With(slog.String("remote_addr", r.RemoteAddr))
+
+	wsgraphql.RequestContext(ctx).Set(contextKeyLogger, logger)
+
+	wsgraphql.ObserveWebsocket(ctx, &connectionObserver{
+		config: c,
+		logger: logger,
+	})
+
+	return handler(ctx, w, r)
+}
+
+func (c *config) interceptInit(ctx context.Context, init apollows.PayloadInit, handler wsgraphql.HandlerInit) error {
+	err := handler(ctx, init)
+
+	if wsgraphql.ContextWebsocketConnection(ctx) == nil {
+		return err
+	}
+
+	logger := ContextLogger(ctx)
+
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelWarn, "connection init failed", slog.String("error", err.Error()))
+	} else {
+		logger.LogAttrs(ctx, c.level, "connection initialized")
+	}
+
+	return err
+}
+
+func (c *config) interceptOperation(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperation,
+) error {
+	opctx := wsgraphql.OperationContext(ctx)
+
+	logger := ContextLogger(ctx)
+
+	if id := wsgraphql.ContextOperationID(ctx); id != "" {
+		logger = logger.With(slog.String("operation_id", id))
+	}
+
+	opctx.Set(contextKeyLogger, logger)
+	opctx.Set(contextKeyOperationState, &operationState{})
+
+	// variables are captured before execution may change them
+	var variables map[string]interface{}
+
+	if payload.Variables != nil {
+		uploadless, _ := replaceUploads(payload.Variables).(map[string]interface{})
+
+		variables = c.redactor(ctx, uploadless)
+	}
+
+	start := time.Now()
+
+	err := handler(ctx, payload)
+
+	logger = ContextLogger(ctx)
+
+	attrs := []slog.Attr{
+		slog.String("operation_type", wsgraphql.ContextOperationType(ctx)),
+		slog.Duration("duration", time.Since(start)),
+	}
+
+	if variables != nil {
+		attrs = append(attrs, slog.Any("variables", variables))
+	}
+
+	if err == nil {
+		logger.LogAttrs(ctx, c.level, "operation completed", attrs...)
+
+		return nil
+	}
+
+	errorCount := 1
+
+	if res, ok := err.(wsgraphql.ResultError); ok && len(res.Result.Errors) > 0 {
+		errorCount = len(res.Result.Errors)
+	}
+
+	attrs = append(attrs, slog.Int("error_count", errorCount), slog.String("error", err.Error()))
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "operation failed", attrs...)
+
+	return err
+}
+
+// interceptOperationParse adds name of the operation selected from parsed document to the operation logger
+func (c *config) interceptOperationParse(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler wsgraphql.HandlerOperationParse,
+) error {
+	err := handler(ctx, payload)
+
+	if def := wsgraphql.ContextOperationDefinition(ctx); def != nil && def.Name != nil && def.Name.Value != "" {
+		wsgraphql.OperationContext(ctx).Set(
+			contextKeyLogger,
+			ContextLogger(ctx).With(slog.String("operation_name", def.Name.Value)),
+		)
+	}
+
+	return err
+}
+
+// redactVariables replaces values of variables with redacted names, at any depth
+func (c *config) redactVariables(_ context.Context, variables map[string]interface{}) map[string]interface{} {
+	res, _ := c.redactValue(variables).(map[string]interface{})
+
+	return res
+}
+
+func (c *config) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+
+		for key, value := range v {
+			if _, ok := c.redacted[strings.ToLower(key)]; ok {
+				res[key] = RedactedValue
+			} else {
+				res[key] = c.redactValue(value)
+			}
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+
+		for i, value := range v {
+			res[i] = c.redactValue(value)
+		}
+
+		return res
+	default:
+		return v
+	}
+}
+
+// replaceUploads returns copy of the value with uploaded files replaced by UploadValue, at any depth
+func replaceUploads(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *wsgraphql.Upload:
+		return UploadValue
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+
+		for key, value := range v {
+			res[key] = replaceUploads(value)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+
+		for i, value := range v {
+			res[i] = replaceUploads(value)
+		}
+
+		return res
+	default:
+		return v
+	}
+}
+
+type contextKeyOperationStateT struct{}
+
+var contextKeyOperationState = contextKeyOperationStateT{}
+
+// operationState counts subscription events of the operation for sampling
+type operationState struct {
+	events int64
+}
+
+type connectionObserver struct {
+	start       time.Time
+	config      *config
+	logger      *slog.Logger
+	subprotocol string
+}
+
+func (observer *connectionObserver) WebsocketConnected(ctx context.Context, subprotocol string) {
+	observer.start = time.Now()
+	observer.subprotocol = subprotocol
+
+	observer.logger.LogAttrs(ctx, observer.config.level, "websocket connected", slog.String("subprotocol", subprotocol))
+}
+
+func (*connectionObserver) WebsocketMessageReceived(context.Context, apollows.Operation, int) {
+}
+
+func (observer *connectionObserver) WebsocketMessageSent(
+	ctx context.Context,
+	operation apollows.Operation,
+	size, _ int,
+) {
+	switch operation {
+	case apollows.OperationData, apollows.OperationNext:
+	default:
+		return
+	}
+
+	state, ok := ctx.Value(contextKeyOperationState).(*operationState)
+	if !ok || !wsgraphql.ContextSubscription(ctx) {
+		return
+	}
+
+	events := atomic.AddInt64(&state.events, 1)
+
+	if (events-1)%int64(observer.config.eventSampling) != 0 {
+		return
+	}
+
+	ContextLogger(ctx).LogAttrs(
+		ctx,
+		slog.LevelDebug,
+		"subscription event",
+		slog.Int64("event", events),
+		slog.Int("size", size),
+	)
+}
+
+func (observer *connectionObserver) WebsocketClosed(ctx context.Context, code int, reason string) {
+	attrs := []slog.Attr{
+		slog.String("subprotocol", observer.subprotocol),
+		slog.Duration("duration", time.Since(observer.start)),
+	}
+
+	if code != 0 {
+		attrs = append(attrs, slog.Int("close_code", code), slog.String("close_reason", reason))
+	}
+
+	observer.logger.LogAttrs(ctx, observer.config.level, "websocket closed", attrs...)
+}
+
+type config struct {
+	logger        *slog.Logger
+	redacted      map[string]struct{}
+	redactor      VariablesRedactor
+	level         slog.Level
+	eventSampling int
+}
+
+type optionFunc func(c *config)
+
+func (o optionFunc) apply(c *config) {
+	o(c)
+}
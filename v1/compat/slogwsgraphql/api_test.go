@@ -0,0 +1,232 @@
+//go:build go1.21
+// +build go1.21
+
+package slogwsgraphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/compat/gorillaws"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBuffer struct {
+	buf bytes.Buffer
+	m   sync.Mutex
+}
+
+func (b *testBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// records returns decoded records with given message
+func (b *testBuffer) records(t *testing.T, msg string) (res []map[string]interface{}) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]interface{}
+
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+
+		if record[slog.MessageKey] == msg {
+			res = append(res, record)
+		}
+	}
+
+	return
+}
+
+func TestNewInterceptors(t *testing.T) {
+	var buf testBuffer
+
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	interceptors := NewInterceptors(WithLogger(logger), WithEventSampling(2))
+
+	interceptors.OperationExecute = func(
+		ctx context.Context,
+		payload *apollows.PayloadOperation,
+		handler wsgraphql.HandlerOperationExecute,
+	) (chan *graphql.Result, error) {
+		ContextLogger(ctx).InfoContext(ctx, "executing")
+
+		return handler(ctx, payload)
+	}
+
+	srv := compattest.NewServer(t, gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	}), wsgraphql.WithExtraInterceptors(interceptors))
+
+	defer srv.Close()
+
+	conn := compattest.Dial(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query Echo($value: String) { echo(value: $value) }`,
+				Variables: map[string]interface{}{
+					"value": "foo",
+					"input": map[string]interface{}{
+						"Password": "bar",
+					},
+				},
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "2",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	}))
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+	}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "3",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { unknown }`,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	assert.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool {
+		return len(buf.records(t, "websocket closed")) == 1 && len(buf.records(t, "subscription event")) == 2
+	}, time.Second, time.Millisecond)
+
+	connected := buf.records(t, "websocket connected")
+
+	if assert.Len(t, connected, 1) {
+		assert.Equal(t, apollows.WebsocketSubprotocolGraphqlTransportWS.String(), connected[0]["subprotocol"])
+		assert.NotEmpty(t, connected[0]["remote_addr"])
+	}
+
+	assert.Len(t, buf.records(t, "connection initialized"), 1)
+
+	executing := buf.records(t, "executing")
+
+	if assert.Len(t, executing, 2) {
+		assert.Equal(t, "1", executing[0]["operation_id"])
+		assert.Equal(t, "Echo", executing[0]["operation_name"])
+	}
+
+	completed := buf.records(t, "operation completed")
+
+	if assert.Len(t, completed, 2) {
+		assert.Equal(t, "query", completed[0]["operation_type"])
+		assert.Equal(t, "Echo", completed[0]["operation_name"])
+		assert.NotContains(t, completed[1], "operation_name")
+		assert.Equal(t, map[string]interface{}{
+			"value": "foo",
+			"input": map[string]interface{}{
+				"Password": RedactedValue,
+			},
+		}, completed[0]["variables"])
+
+		assert.Equal(t, "subscription", completed[1]["operation_type"])
+	}
+
+	events := buf.records(t, "subscription event")
+
+	if assert.Len(t, events, 2) {
+		assert.EqualValues(t, 1, events[0]["event"])
+		assert.EqualValues(t, 3, events[1]["event"])
+	}
+
+	failed := buf.records(t, "operation failed")
+
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "3", failed[0]["operation_id"])
+		assert.EqualValues(t, 1, failed[0]["error_count"])
+	}
+}
+
+func TestUploadsReplaced(t *testing.T) {
+	var buf testBuffer
+
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	interceptors := NewInterceptors(WithLogger(logger))
+
+	opctx := mutable.NewMutableContext(context.Background())
+
+	opctx.Set(wsgraphql.ContextKeyOperationContext, opctx)
+	opctx.Set(contextKeyLogger, logger)
+
+	err := interceptors.Operation(opctx, &apollows.PayloadOperation{
+		Query: `mutation ($file: Upload!, $files: [Upload]) { upload(file: $file) uploads(files: $files) }`,
+		Variables: map[string]interface{}{
+			"file":  &wsgraphql.Upload{},
+			"files": []interface{}{&wsgraphql.Upload{}},
+			"token": "foo",
+		},
+	}, func(ctx context.Context, payload *apollows.PayloadOperation) error {
+		return nil
+	})
+
+	assert.NoError(t, err)
+
+	completed := buf.records(t, "operation completed")
+
+	if assert.Len(t, completed, 1) {
+		assert.Equal(t, map[string]interface{}{
+			"file":  UploadValue,
+			"files": []interface{}{UploadValue},
+			"token": RedactedValue,
+		}, completed[0]["variables"])
+	}
+}
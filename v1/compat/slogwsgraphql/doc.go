@@ -0,0 +1,3 @@
+// Package slogwsgraphql provides structured logging of wsgraphql connections and operations with log/slog, available
+// with go1.21 and newer
+package slogwsgraphql
@@ -0,0 +1,200 @@
+// Package stdws provides dependency-free websocket upgrader implementing RFC 6455 on top of http.Hijacker
+package stdws
+
+import (
+	"crypto/sha1" //nolint:gosec // mandated by RFC 6455 handshake
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+)
+
+// websocketGUID is appended to client key to compute accept key, as per RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	errMethodNotAllowed   = errors.New("websocket: request method is not GET")
+	errNotUpgrade         = errors.New("websocket: 'upgrade' token not found in 'Connection' header")
+	errNotWebsocket       = errors.New("websocket: 'websocket' token not found in 'Upgrade' header")
+	errUnsupportedVersion = errors.New("websocket: unsupported version, 'Sec-Websocket-Version' must be 13")
+	errInvalidKey         = errors.New("websocket: 'Sec-WebSocket-Key' header is missing or invalid")
+	errOriginNotAllowed   = errors.New("websocket: request origin not allowed")
+	errHijackNotSupported = errors.New("websocket: response does not implement http.Hijacker")
+)
+
+// Upgrader implements wsgraphql.Upgrader without third-party dependencies
+type Upgrader struct {
+	// CheckOrigin returns true if request origin is acceptable, by default only same-host origins are accepted
+	CheckOrigin func(r *http.Request) bool
+
+	// Subprotocols lists supported subprotocols, by default subprotocols configured on wsgraphql server are used
+	Subprotocols []string
+
+	// ReadLimit sets maximum size of incoming message in bytes, unlimited if zero or negative
+	ReadLimit int64
+
+	// HandshakeTimeout sets timeout for writing handshake response, unlimited if zero
+	HandshakeTimeout time.Duration
+}
+
+// Upgrade implementation
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (wsgraphql.Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, u.fail(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	}
+
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return nil, u.fail(w, http.StatusBadRequest, errNotUpgrade)
+	}
+
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, u.fail(w, http.StatusBadRequest, errNotWebsocket)
+	}
+
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+
+		return nil, u.fail(w, http.StatusUpgradeRequired, errUnsupportedVersion)
+	}
+
+	key := r.Header.Get("Sec-Websocket-Key")
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return nil, u.fail(w, http.StatusBadRequest, errInvalidKey)
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	if !checkOrigin(r) {
+		return nil, u.fail(w, http.StatusForbidden, errOriginNotAllowed)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, u.fail(w, http.StatusInternalServerError, errHijackNotSupported)
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+
+	netconn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+
+	if subprotocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+
+	for k, vs := range responseHeader {
+		if k == "Sec-Websocket-Protocol" {
+			continue
+		}
+
+		for _, v := range vs {
+			sb.WriteString(k + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(v) + "\r\n")
+		}
+	}
+
+	sb.WriteString("\r\n")
+
+	if u.HandshakeTimeout > 0 {
+		_ = netconn.SetWriteDeadline(time.Now().Add(u.HandshakeTimeout))
+	}
+
+	_, err = netconn.Write([]byte(sb.String()))
+	if err != nil {
+		_ = netconn.Close()
+
+		return nil, err
+	}
+
+	_ = netconn.SetWriteDeadline(time.Time{})
+
+	c := newConn(netconn, brw.Reader, subprotocol, u.ReadLimit)
+
+	c.json = wsgraphql.ContextJSONCodec(r.Context())
+
+	return c, nil
+}
+
+func (u *Upgrader) fail(w http.ResponseWriter, status int, err error) error {
+	http.Error(w, http.StatusText(status), status)
+
+	return err
+}
+
+// selectSubprotocol returns first client-requested subprotocol supported by the upgrader or the server
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	supported := u.Subprotocols
+	if supported == nil {
+		supported = wsgraphql.ContextSubprotocols(r.Context())
+	}
+
+	for _, requested := range headerTokens(r.Header, "Sec-Websocket-Protocol") {
+		for _, s := range supported {
+			if requested == s {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.New() //nolint:gosec // mandated by RFC 6455 handshake
+
+	h.Write([]byte(key + websocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func headerTokens(header http.Header, name string) (tokens []string) {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	return
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package stdws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/compat/internal/compattest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgrader(t *testing.T) {
+	compattest.RunUpgraderSuite(t, &Upgrader{})
+}
+
+func TestUpgraderSubprotocols(t *testing.T) {
+	compattest.RunUpgraderSuite(t, &Upgrader{
+		Subprotocols: compattest.Subprotocols,
+	})
+}
+
+func TestUpgraderHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		method string
+		header http.Header
+		status int
+	}{
+		{
+			name:   "Method",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "Connection",
+			header: http.Header{
+				"Connection": []string{"keep-alive"},
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "Upgrade",
+			header: http.Header{
+				"Upgrade": []string{"h2c"},
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "Version",
+			header: http.Header{
+				"Sec-Websocket-Version": []string{"8"},
+			},
+			status: http.StatusUpgradeRequired,
+		},
+		{
+			name: "Key",
+			header: http.Header{
+				"Sec-Websocket-Key": []string{"Zm9v"},
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "Origin",
+			header: http.Header{
+				"Origin": []string{"http://example.com"},
+			},
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := testHandshakeHeader()
+
+			for k, v := range tc.header {
+				header[k] = v
+			}
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			r := httptest.NewRequest(method, "http://localhost/", nil)
+			r.Header = header
+
+			w := httptest.NewRecorder()
+
+			c, err := (&Upgrader{}).Upgrade(w, r, nil)
+
+			assert.Error(t, err)
+			assert.Nil(t, c)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+func TestUpgraderSelectSubprotocol(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+
+	r.Header.Set("Sec-Websocket-Protocol", "foo, graphql-ws, graphql-transport-ws")
+
+	assert.Equal(t, "", (&Upgrader{}).selectSubprotocol(r))
+
+	r = r.WithContext(context.WithValue(r.Context(), wsgraphql.ContextKeySubprotocols, []string{
+		"graphql-transport-ws",
+		"graphql-ws",
+	}))
+
+	assert.Equal(t, "graphql-ws", (&Upgrader{}).selectSubprotocol(r))
+
+	assert.Equal(t, "foo", (&Upgrader{
+		Subprotocols: []string{"bar", "foo"},
+	}).selectSubprotocol(r))
+}
+
+func TestAcceptKey(t *testing.T) {
+	// example from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func testHandshakeHeader() http.Header {
+	return http.Header{
+		"Connection":            []string{"keep-alive, Upgrade"},
+		"Upgrade":               []string{"websocket"},
+		"Sec-Websocket-Version": []string{"13"},
+		"Sec-Websocket-Key":     []string{"dGhlIHNhbXBsZSBub25jZQ=="},
+	}
+}
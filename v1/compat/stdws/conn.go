@@ -0,0 +1,406 @@
+package stdws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// Message types, as defined by RFC 6455 section 11.8
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes, as defined by RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	maxControlPayload = 125
+	maxCloseReason    = maxControlPayload - 2
+)
+
+var (
+	errCloseSent          = errors.New("websocket: close frame already sent")
+	errInvalidMessageType = errors.New("websocket: invalid message type")
+)
+
+// CloseError is returned from read methods once close frame is received or connection is failed due to protocol
+// violation
+type CloseError struct {
+	Text string
+	Code int
+}
+
+// Error implementation
+func (err *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(err.Code) + " " + err.Text
+}
+
+type conn struct {
+	netconn     net.Conn
+	reader      *bufio.Reader
+	json        apollows.JSONCodec
+	readErr     error
+	subprotocol string
+	readLimit   int64
+	closeOnce   sync.Once
+	wm          sync.Mutex
+	closeSent   bool
+}
+
+func newConn(netconn net.Conn, reader *bufio.Reader, subprotocol string, readLimit int64) *conn {
+	return &conn{
+		netconn:     netconn,
+		reader:      reader,
+		subprotocol: subprotocol,
+		readLimit:   readLimit,
+		json:        apollows.StdJSONCodec{},
+	}
+}
+
+// ReadJSON reads next message and decodes it as JSON into v
+func (c *conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return c.json.Unmarshal(data, v)
+}
+
+// WriteJSON encodes v as JSON and writes it as a text message
+func (c *conn) WriteJSON(v interface{}) error {
+	data, err := c.json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(TextMessage, data)
+}
+
+// Close sends close frame with provided code and message, unless one was sent already, and closes connection
+func (c *conn) Close(code int, message string) error {
+	err := c.writeClose(code, message)
+	if errors.Is(err, errCloseSent) {
+		err = nil
+	}
+
+	c.closeOnce.Do(func() {
+		cerr := c.netconn.Close()
+		if err == nil {
+			err = cerr
+		}
+	})
+
+	return err
+}
+
+// Subprotocol returns negotiated subprotocol
+func (c *conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage reads next complete text or binary message, replying to pings and close frames along the way.
+// Once error is returned, all subsequent calls return the same error.
+func (c *conn) ReadMessage() (messageType int, data []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	messageType, data, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+
+	return
+}
+
+// WriteMessage writes data as a single unfragmented frame of given message type
+func (c *conn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return errInvalidMessageType
+		}
+	default:
+		return errInvalidMessageType
+	}
+
+	c.wm.Lock()
+	defer c.wm.Unlock()
+
+	return c.writeFrame(messageType, data)
+}
+
+func (c *conn) readMessage() (messageType int, data []byte, err error) {
+	var buf bytes.Buffer
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			c.wm.Lock()
+			err = c.writeFrame(PongMessage, payload)
+			c.wm.Unlock()
+
+			if err != nil && !errors.Is(err, errCloseSent) {
+				return 0, nil, err
+			}
+
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+
+			messageType = opcode
+		}
+
+		buf.Write(payload)
+
+		if c.readLimit > 0 && int64(buf.Len()) > c.readLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+
+		if !fin {
+			continue
+		}
+
+		if messageType == TextMessage && !utf8.Valid(buf.Bytes()) {
+			return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid utf-8 in text message")
+		}
+
+		return messageType, buf.Bytes(), nil
+	}
+}
+
+func (c *conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var hdr [8]byte
+
+	_, err = io.ReadFull(c.reader, hdr[:2])
+	if err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+
+	fin = hdr[0]&0x80 != 0
+	opcode = int(hdr[0] & 0x0f)
+	masked := hdr[1]&0x80 != 0
+	length := uint64(hdr[1] & 0x7f)
+
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+
+	switch length {
+	case 126:
+		_, err = io.ReadFull(c.reader, hdr[:2])
+		length = uint64(binary.BigEndian.Uint16(hdr[:2]))
+	case 127:
+		_, err = io.ReadFull(c.reader, hdr[:8])
+		length = binary.BigEndian.Uint64(hdr[:8])
+	}
+
+	if err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+		if length>>63 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	default:
+		return false, 0, nil, c.fail(CloseProtocolError, "unknown opcode "+strconv.Itoa(opcode))
+	}
+
+	if !masked {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frame is not masked")
+	}
+
+	if c.readLimit > 0 && length > uint64(c.readLimit) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+
+	_, err = io.ReadFull(c.reader, mask[:])
+	if err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+
+	// payload is read incrementally so that declared length alone does not cause large allocation
+	var buf bytes.Buffer
+
+	_, err = io.CopyN(&buf, c.reader, int64(length))
+	if err != nil {
+		return false, 0, nil, c.abort(err)
+	}
+
+	payload = buf.Bytes()
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (c *conn) handleClose(payload []byte) error {
+	code, text := CloseNoStatusReceived, ""
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		code, text = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, "invalid close code "+strconv.Itoa(code))
+		}
+
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidFramePayloadData, "invalid utf-8 in close reason")
+		}
+	}
+
+	_ = c.Close(code, "")
+
+	return &CloseError{
+		Code: code,
+		Text: text,
+	}
+}
+
+// fail closes connection due to protocol violation with given code, returning corresponding error
+func (c *conn) fail(code int, text string) error {
+	_ = c.Close(code, text)
+
+	return &CloseError{
+		Code: code,
+		Text: text,
+	}
+}
+
+// abort closes connection without closing handshake
+func (c *conn) abort(err error) error {
+	c.closeOnce.Do(func() {
+		_ = c.netconn.Close()
+	})
+
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func (c *conn) writeClose(code int, message string) error {
+	var payload []byte
+
+	if code != CloseNoStatusReceived {
+		if len(message) > maxCloseReason {
+			message = message[:maxCloseReason]
+
+			for len(message) > 0 && !utf8.ValidString(message) {
+				message = message[:len(message)-1]
+			}
+		}
+
+		payload = make([]byte, 2+len(message))
+
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		copy(payload[2:], message)
+	}
+
+	c.wm.Lock()
+	defer c.wm.Unlock()
+
+	err := c.writeFrame(CloseMessage, payload)
+
+	c.closeSent = true
+
+	return err
+}
+
+// writeFrame writes single unmasked final frame, must be called with write mutex held
+func (c *conn) writeFrame(opcode int, payload []byte) error {
+	if c.closeSent {
+		return errCloseSent
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+
+	frame = append(frame, 0x80|byte(opcode))
+
+	switch length := len(payload); {
+	case length <= maxControlPayload:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	frame = append(frame, payload...)
+
+	_, err := c.netconn.Write(frame)
+
+	return err
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,542 @@
+package stdws
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1"
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFrame describes single frame sent by test client or expected from server
+type testFrame struct {
+	payload []byte
+	opcode  int
+	rsv     byte
+	nofin   bool
+}
+
+// testCase is modelled after autobahn testsuite cases: client sends frames, expecting given frames in reply followed
+// by close frame with given code, or normal closing handshake if code is 0
+type testCase struct {
+	name      string
+	send      []testFrame
+	expect    []testFrame
+	closeCode int
+}
+
+func testText(s string) testFrame {
+	return testFrame{
+		opcode:  TextMessage,
+		payload: []byte(s),
+	}
+}
+
+func testClosePayload(code int, reason string) []byte {
+	payload := make([]byte, 2+len(reason))
+
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+
+	return payload
+}
+
+func testCases() []testCase {
+	large := strings.Repeat("*", 1<<20)
+
+	return []testCase{
+		// 1 framing
+		{name: "1.1.1 empty text", send: []testFrame{testText("")}, expect: []testFrame{testText("")}},
+		{
+			name:   "1.1.2 text 125",
+			send:   []testFrame{testText(strings.Repeat("*", 125))},
+			expect: []testFrame{testText(strings.Repeat("*", 125))},
+		},
+		{
+			name:   "1.1.3 text 126",
+			send:   []testFrame{testText(strings.Repeat("*", 126))},
+			expect: []testFrame{testText(strings.Repeat("*", 126))},
+		},
+		{
+			name:   "1.1.4 text 65535",
+			send:   []testFrame{testText(strings.Repeat("*", 65535))},
+			expect: []testFrame{testText(strings.Repeat("*", 65535))},
+		},
+		{
+			name:   "1.1.5 text 65536",
+			send:   []testFrame{testText(strings.Repeat("*", 65536))},
+			expect: []testFrame{testText(strings.Repeat("*", 65536))},
+		},
+		{
+			name:   "1.2.1 binary",
+			send:   []testFrame{{opcode: BinaryMessage, payload: []byte{0xfe, 0xff}}},
+			expect: []testFrame{{opcode: BinaryMessage, payload: []byte{0xfe, 0xff}}},
+		},
+		// 2 ping/pong
+		{
+			name:   "2.1 ping empty",
+			send:   []testFrame{{opcode: PingMessage}},
+			expect: []testFrame{{opcode: PongMessage}},
+		},
+		{
+			name:   "2.4 ping 125",
+			send:   []testFrame{{opcode: PingMessage, payload: bytes.Repeat([]byte{0xfe}, 125)}},
+			expect: []testFrame{{opcode: PongMessage, payload: bytes.Repeat([]byte{0xfe}, 125)}},
+		},
+		{
+			name:      "2.5 ping 126",
+			send:      []testFrame{{opcode: PingMessage, payload: bytes.Repeat([]byte{0xfe}, 126)}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "2.6 unsolicited pong",
+			send: []testFrame{{opcode: PongMessage, payload: []byte("foo")}, testText("bar")},
+			expect: []testFrame{
+				testText("bar"),
+			},
+		},
+		{
+			name: "2.10 multiple pings",
+			send: []testFrame{
+				{opcode: PingMessage, payload: []byte("1")},
+				{opcode: PingMessage, payload: []byte("2")},
+			},
+			expect: []testFrame{
+				{opcode: PongMessage, payload: []byte("1")},
+				{opcode: PongMessage, payload: []byte("2")},
+			},
+		},
+		// 3 reserved bits
+		{
+			name:      "3.1 text rsv1",
+			send:      []testFrame{{opcode: TextMessage, payload: []byte("foo"), rsv: 0x40}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "3.7 close rsv7",
+			send:      []testFrame{{opcode: CloseMessage, rsv: 0x70}},
+			closeCode: CloseProtocolError,
+		},
+		// 4 opcodes
+		{
+			name:      "4.1.1 reserved non-control opcode",
+			send:      []testFrame{{opcode: 3}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "4.2.1 reserved control opcode",
+			send:      []testFrame{{opcode: 11}},
+			closeCode: CloseProtocolError,
+		},
+		// 5 fragmentation
+		{
+			name:      "5.1 fragmented ping",
+			send:      []testFrame{{opcode: PingMessage, nofin: true}, {opcode: continuationFrame}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "5.3 fragmented text",
+			send: []testFrame{
+				{opcode: TextMessage, payload: []byte("foo"), nofin: true},
+				{opcode: continuationFrame, payload: []byte("bar"), nofin: true},
+				{opcode: continuationFrame, payload: []byte("baz")},
+			},
+			expect: []testFrame{testText("foobarbaz")},
+		},
+		{
+			name: "5.6 fragmented text with ping",
+			send: []testFrame{
+				{opcode: TextMessage, payload: []byte("foo"), nofin: true},
+				{opcode: PingMessage, payload: []byte("ping")},
+				{opcode: continuationFrame, payload: []byte("bar")},
+			},
+			expect: []testFrame{
+				{opcode: PongMessage, payload: []byte("ping")},
+				testText("foobar"),
+			},
+		},
+		{
+			name:      "5.9 continuation without start",
+			send:      []testFrame{{opcode: continuationFrame, payload: []byte("foo")}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "5.18 interleaved messages",
+			send: []testFrame{
+				{opcode: TextMessage, payload: []byte("foo"), nofin: true},
+				{opcode: TextMessage, payload: []byte("bar")},
+			},
+			closeCode: CloseProtocolError,
+		},
+		// 6 utf-8
+		{
+			name:   "6.2.1 valid utf-8",
+			send:   []testFrame{testText("κόσμε")},
+			expect: []testFrame{testText("κόσμε")},
+		},
+		{
+			name: "6.2.3 valid utf-8 split across fragments",
+			send: []testFrame{
+				{opcode: TextMessage, payload: []byte("κ")[:1], nofin: true},
+				{opcode: continuationFrame, payload: []byte("κ")[1:]},
+			},
+			expect: []testFrame{testText("κ")},
+		},
+		{
+			name:      "6.3.1 invalid utf-8",
+			send:      []testFrame{{opcode: TextMessage, payload: []byte{0xce, 0xba, 0xe1, 0xbd}}},
+			closeCode: CloseInvalidFramePayloadData,
+		},
+		// 7 close handling
+		{
+			name:      "7.1.1 close empty",
+			send:      []testFrame{{opcode: CloseMessage}},
+			closeCode: CloseNoStatusReceived,
+		},
+		{
+			name:      "7.1.2 messages after close ignored",
+			send:      []testFrame{{opcode: CloseMessage}, testText("foo")},
+			closeCode: CloseNoStatusReceived,
+		},
+		{
+			name:      "7.3.2 close one byte payload",
+			send:      []testFrame{{opcode: CloseMessage, payload: []byte{0x03}}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "7.3.3 close with reason",
+			send:      []testFrame{{opcode: CloseMessage, payload: testClosePayload(4400, "bye")}},
+			closeCode: 4400,
+		},
+		{
+			name:      "7.5.1 close invalid utf-8 reason",
+			send:      []testFrame{{opcode: CloseMessage, payload: testClosePayload(1000, "\xce\xba\xe1\xbd")}},
+			closeCode: CloseInvalidFramePayloadData,
+		},
+		{
+			name:      "7.9.1 close code 0",
+			send:      []testFrame{{opcode: CloseMessage, payload: testClosePayload(0, "")}},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "7.9.6 close code 1005",
+			send:      []testFrame{{opcode: CloseMessage, payload: testClosePayload(1005, "")}},
+			closeCode: CloseProtocolError,
+		},
+		// 9 limits
+		{
+			name:   "9.1.3 text 1MiB",
+			send:   []testFrame{testText(large)},
+			expect: []testFrame{testText(large)},
+		},
+		{
+			name: "9.2.3 text 1MiB in 64KiB fragments",
+			send: func() (frames []testFrame) {
+				for i := 0; i < len(large); i += 1 << 16 {
+					frames = append(frames, testFrame{
+						opcode:  continuationFrame,
+						payload: []byte(large[i : i+1<<16]),
+						nofin:   i+1<<16 < len(large),
+					})
+				}
+
+				frames[0].opcode = TextMessage
+
+				return
+			}(),
+			expect: []testFrame{testText(large)},
+		},
+	}
+}
+
+func testEchoServer(t *testing.T, upgrader *Upgrader) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsconn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		c, ok := wsconn.(*conn)
+
+		assert.True(t, ok)
+
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			err = c.WriteMessage(typ, data)
+			if err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func testDial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	netconn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+
+	assert.NoError(t, err)
+
+	_ = netconn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	assert.NoError(t, err)
+
+	req.Header = testHandshakeHeader()
+
+	assert.NoError(t, req.Write(netconn))
+
+	reader := bufio.NewReader(netconn)
+
+	resp, err := http.ReadResponse(reader, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-Websocket-Accept"))
+
+	return netconn, reader
+}
+
+func testWriteFrame(t *testing.T, w io.Writer, frame testFrame) {
+	var buf bytes.Buffer
+
+	b0 := byte(frame.opcode) | frame.rsv
+	if !frame.nofin {
+		b0 |= 0x80
+	}
+
+	buf.WriteByte(b0)
+
+	switch length := len(frame.payload); {
+	case length <= 125:
+		buf.WriteByte(0x80 | byte(length))
+	case length <= 0xffff:
+		buf.WriteByte(0x80 | 126)
+		_ = binary.Write(&buf, binary.BigEndian, uint16(length))
+	default:
+		buf.WriteByte(0x80 | 127)
+		_ = binary.Write(&buf, binary.BigEndian, uint64(length))
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+
+	buf.Write(mask)
+
+	for i, b := range frame.payload {
+		buf.WriteByte(b ^ mask[i%4])
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	assert.NoError(t, err)
+}
+
+func testReadFrame(t *testing.T, r io.Reader) testFrame {
+	var hdr [8]byte
+
+	_, err := io.ReadFull(r, hdr[:2])
+	if !assert.NoError(t, err) {
+		return testFrame{}
+	}
+
+	assert.NotZero(t, hdr[0]&0x80, "server frames must be final")
+	assert.Zero(t, hdr[1]&0x80, "server frames must not be masked")
+
+	opcode := int(hdr[0] & 0x0f)
+	length := uint64(hdr[1] & 0x7f)
+
+	switch length {
+	case 126:
+		_, err = io.ReadFull(r, hdr[:2])
+		length = uint64(binary.BigEndian.Uint16(hdr[:2]))
+	case 127:
+		_, err = io.ReadFull(r, hdr[:8])
+		length = binary.BigEndian.Uint64(hdr[:8])
+	}
+
+	assert.NoError(t, err)
+
+	payload := make([]byte, length)
+
+	_, err = io.ReadFull(r, payload)
+
+	assert.NoError(t, err)
+
+	return testFrame{
+		opcode:  opcode,
+		payload: payload,
+	}
+}
+
+func testRunCase(t *testing.T, srv *httptest.Server, tc testCase) {
+	netconn, reader := testDial(t, srv)
+
+	defer func() {
+		_ = netconn.Close()
+	}()
+
+	for _, frame := range tc.send {
+		testWriteFrame(t, netconn, frame)
+	}
+
+	for _, expected := range tc.expect {
+		frame := testReadFrame(t, reader)
+
+		assert.Equal(t, expected.opcode, frame.opcode)
+		assert.Equal(t, len(expected.payload), len(frame.payload))
+		assert.True(t, bytes.Equal(expected.payload, frame.payload))
+	}
+
+	closeCode := tc.closeCode
+
+	if closeCode == 0 {
+		closeCode = CloseNormalClosure
+
+		testWriteFrame(t, netconn, testFrame{
+			opcode:  CloseMessage,
+			payload: testClosePayload(closeCode, ""),
+		})
+	}
+
+	frame := testReadFrame(t, reader)
+
+	assert.Equal(t, CloseMessage, frame.opcode)
+
+	if closeCode == CloseNoStatusReceived {
+		assert.Empty(t, frame.payload)
+	} else if assert.GreaterOrEqual(t, len(frame.payload), 2) {
+		assert.Equal(t, closeCode, int(binary.BigEndian.Uint16(frame.payload)))
+	}
+
+	// server closes TCP connection after closing handshake
+	_, err := reader.ReadByte()
+
+	assert.Error(t, err)
+}
+
+func TestConnCases(t *testing.T) {
+	srv := testEchoServer(t, &Upgrader{})
+
+	defer srv.Close()
+
+	for _, tc := range testCases() {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testRunCase(t, srv, tc)
+		})
+	}
+}
+
+func TestConnReadLimit(t *testing.T) {
+	srv := testEchoServer(t, &Upgrader{
+		ReadLimit: 16,
+	})
+
+	defer srv.Close()
+
+	testRunCase(t, srv, testCase{
+		send:      []testFrame{testText(strings.Repeat("*", 16))},
+		expect:    []testFrame{testText(strings.Repeat("*", 16))},
+		closeCode: 0,
+	})
+
+	testRunCase(t, srv, testCase{
+		send:      []testFrame{testText(strings.Repeat("*", 17))},
+		closeCode: CloseMessageTooBig,
+	})
+
+	testRunCase(t, srv, testCase{
+		send: []testFrame{
+			{opcode: TextMessage, payload: []byte(strings.Repeat("*", 10)), nofin: true},
+			{opcode: continuationFrame, payload: []byte(strings.Repeat("*", 10))},
+		},
+		closeCode: CloseMessageTooBig,
+	})
+}
+
+func TestConnUnmasked(t *testing.T) {
+	srv := testEchoServer(t, &Upgrader{})
+
+	defer srv.Close()
+
+	netconn, reader := testDial(t, srv)
+
+	defer func() {
+		_ = netconn.Close()
+	}()
+
+	_, err := netconn.Write([]byte{0x81, 0x03, 'f', 'o', 'o'})
+
+	assert.NoError(t, err)
+
+	frame := testReadFrame(t, reader)
+
+	assert.Equal(t, CloseMessage, frame.opcode)
+	assert.Equal(t, CloseProtocolError, int(binary.BigEndian.Uint16(frame.payload)))
+}
+
+func TestConnCloseReason(t *testing.T) {
+	client, server := net.Pipe()
+
+	c := newConn(server, bufio.NewReader(server), "", 0)
+
+	go func() {
+		_ = c.Close(4400, strings.Repeat("ж", 100))
+	}()
+
+	frame := testReadFrame(t, client)
+
+	assert.Equal(t, CloseMessage, frame.opcode)
+	assert.LessOrEqual(t, len(frame.payload), maxControlPayload)
+	assert.Equal(t, 4400, int(binary.BigEndian.Uint16(frame.payload)))
+
+	_ = client.Close()
+}
+
+type testJSONCodec struct {
+	apollows.StdJSONCodec
+}
+
+func (testJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(`"custom"`), nil
+}
+
+func TestConnJSONCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), wsgraphql.ContextKeyJSONCodec, testJSONCodec{})
+
+		wsconn, err := (&Upgrader{}).Upgrade(w, r.WithContext(ctx), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, wsconn.WriteJSON(map[string]interface{}{"foo": "bar"}))
+	}))
+
+	defer srv.Close()
+
+	netconn, reader := testDial(t, srv)
+
+	defer func() {
+		_ = netconn.Close()
+	}()
+
+	frame := testReadFrame(t, reader)
+
+	assert.Equal(t, TextMessage, frame.opcode)
+	assert.Equal(t, `"custom"`, string(frame.payload))
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/graphql-go/graphql"
 
+	"github.com/eientei/wsgraphql/v1/apollows"
 	"github.com/eientei/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql/language/ast"
 )
@@ -18,11 +19,24 @@ type (
 	contextKeyOperationIDT         struct{}
 	contextKeyOperationParamsT     struct{}
 	contextKeyAstT                 struct{}
+	contextKeyOperationDefinitionT struct{}
 	contextKeySubscriptionT        struct{}
 	contextKeyHTTPRequestT         struct{}
 	contextKeyHTTPResponseWriterT  struct{}
 	contextKeyHTTPResponseStartedT struct{}
 	contextKeyWebsocketConnectionT struct{}
+	contextKeySubprotocolsT        struct{}
+	contextKeyJSONCodecT           struct{}
+	contextKeyLastEventIDT         struct{}
+	contextKeyIncrementalT         struct{}
+	contextKeyBatchIndexT          struct{}
+	contextKeyEventCursorT         struct{}
+	contextKeyDetachedT            struct{}
+	contextKeySchemaStateT         struct{}
+	contextKeyRootObjectT          struct{}
+	contextKeyWebsocketObserversT  struct{}
+	contextKeyErrorPresenterT      struct{}
+	contextKeyPanicHandlerT        struct{}
 )
 
 var (
@@ -47,6 +61,9 @@ var (
 	// ContextKeyAST used to store operation's ast.Document (abstract syntax tree)
 	ContextKeyAST = contextKeyAstT{}
 
+	// ContextKeyOperationDefinition used to store operation definition selected from operation's ast.Document
+	ContextKeyOperationDefinition = contextKeyOperationDefinitionT{}
+
 	// ContextKeySubscription used to store operation subscription flag
 	ContextKeySubscription = contextKeySubscriptionT{}
 
@@ -61,6 +78,30 @@ var (
 
 	// ContextKeyWebsocketConnection used to store websocket connection
 	ContextKeyWebsocketConnection = contextKeyWebsocketConnectionT{}
+
+	// ContextKeySubprotocols used to store websocket subprotocols supported by the server, available to Upgrader
+	ContextKeySubprotocols = contextKeySubprotocolsT{}
+
+	// ContextKeyJSONCodec used to store apollows.JSONCodec of the server, available to Upgrader and Executor
+	ContextKeyJSONCodec = contextKeyJSONCodecT{}
+
+	// ContextKeyLastEventID used to store subscription event ID client requested to resume after
+	ContextKeyLastEventID = contextKeyLastEventIDT{}
+
+	// ContextKeyIncremental used to store operation incremental delivery flag, set when @defer is in effect
+	ContextKeyIncremental = contextKeyIncrementalT{}
+
+	// ContextKeyBatchIndex used to store operation index within HTTP query batch
+	ContextKeyBatchIndex = contextKeyBatchIndexT{}
+
+	contextKeyEventCursor = contextKeyEventCursorT{}
+	contextKeyDetached    = contextKeyDetachedT{}
+	contextKeySchemaState = contextKeySchemaStateT{}
+	contextKeyRootObject  = contextKeyRootObjectT{}
+
+	contextKeyWebsocketObservers = contextKeyWebsocketObserversT{}
+	contextKeyErrorPresenter     = contextKeyErrorPresenterT{}
+	contextKeyPanicHandler       = contextKeyPanicHandlerT{}
 )
 
 func defaultMutcontext(ctx context.Context, mutctx mutable.Context) mutable.Context {
@@ -184,6 +225,32 @@ func ContextAST(ctx context.Context) *ast.Document {
 	return astdoc
 }
 
+// ContextOperationDefinition returns operation definition selected from operation's document by operation name
+func ContextOperationDefinition(ctx context.Context) *ast.OperationDefinition {
+	v := ctx.Value(ContextKeyOperationDefinition)
+	if v == nil {
+		return nil
+	}
+
+	op, ok := v.(*ast.OperationDefinition)
+	if !ok {
+		return nil
+	}
+
+	return op
+}
+
+// ContextOperationType returns type of the selected operation: query, mutation or subscription, or empty string if
+// operation was not parsed
+func ContextOperationType(ctx context.Context) string {
+	op := ContextOperationDefinition(ctx)
+	if op == nil {
+		return ""
+	}
+
+	return op.Operation
+}
+
 // ContextSubscription returns operation's subscription flag
 func ContextSubscription(ctx context.Context) bool {
 	v := ctx.Value(ContextKeySubscription)
@@ -199,6 +266,36 @@ func ContextSubscription(ctx context.Context) bool {
 	return sub
 }
 
+// ContextIncremental returns operation's incremental delivery flag
+func ContextIncremental(ctx context.Context) bool {
+	v := ctx.Value(ContextKeyIncremental)
+	if v == nil {
+		return false
+	}
+
+	incremental, ok := v.(bool)
+	if !ok {
+		return false
+	}
+
+	return incremental
+}
+
+// ContextBatchIndex returns operation index within HTTP query batch, or -1 if operation is not part of a batch
+func ContextBatchIndex(ctx context.Context) int {
+	v := ctx.Value(ContextKeyBatchIndex)
+	if v == nil {
+		return -1
+	}
+
+	idx, ok := v.(int)
+	if !ok {
+		return -1
+	}
+
+	return idx
+}
+
 // ContextHTTPRequest returns http request stored in a context
 func ContextHTTPRequest(ctx context.Context) *http.Request {
 	v := ctx.Value(ContextKeyHTTPRequest)
@@ -258,3 +355,43 @@ func ContextWebsocketConnection(ctx context.Context) Conn {
 
 	return conn
 }
+
+// ContextSubprotocols returns websocket subprotocols supported by the server, or nil if none present
+func ContextSubprotocols(ctx context.Context) []string {
+	v := ctx.Value(ContextKeySubprotocols)
+	if v == nil {
+		return nil
+	}
+
+	protocols, ok := v.([]string)
+	if !ok {
+		return nil
+	}
+
+	return protocols
+}
+
+// ContextJSONCodec returns apollows.JSONCodec of the server, or apollows.StdJSONCodec if none present
+func ContextJSONCodec(ctx context.Context) apollows.JSONCodec {
+	codec, ok := ctx.Value(ContextKeyJSONCodec).(apollows.JSONCodec)
+	if !ok || codec == nil {
+		return apollows.StdJSONCodec{}
+	}
+
+	return codec
+}
+
+// ContextLastEventID returns subscription event ID client requested to resume after, or empty string if none present
+func ContextLastEventID(ctx context.Context) string {
+	v := ctx.Value(ContextKeyLastEventID)
+	if v == nil {
+		return ""
+	}
+
+	id, ok := v.(string)
+	if !ok {
+		return ""
+	}
+
+	return id
+}
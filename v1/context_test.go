@@ -163,3 +163,31 @@ func TestContextOperationStopped(t *testing.T) {
 
 	assert.Equal(t, false, ContextOperationStopped(mutctx))
 }
+
+func TestContextLastEventID(t *testing.T) {
+	mutctx := mutable.NewMutableContext(context.Background())
+
+	assert.Equal(t, "", ContextLastEventID(mutctx))
+
+	mutctx.Set(ContextKeyLastEventID, "5")
+
+	assert.Equal(t, "5", ContextLastEventID(mutctx))
+
+	mutctx.Set(ContextKeyLastEventID, 123)
+
+	assert.Equal(t, "", ContextLastEventID(mutctx))
+}
+
+func TestContextSubprotocols(t *testing.T) {
+	mutctx := mutable.NewMutableContext(context.Background())
+
+	assert.Nil(t, ContextSubprotocols(mutctx))
+
+	mutctx.Set(ContextKeySubprotocols, []string{"graphql-ws"})
+
+	assert.Equal(t, []string{"graphql-ws"}, ContextSubprotocols(mutctx))
+
+	mutctx.Set(ContextKeySubprotocols, 123)
+
+	assert.Nil(t, ContextSubprotocols(mutctx))
+}
@@ -1,6 +1,13 @@
 package wsgraphql
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
 	"github.com/graphql-go/graphql/gqlerrors"
 	"github.com/graphql-go/graphql/language/location"
 )
@@ -35,3 +42,123 @@ func FormatError(err error) gqlerrors.FormattedError {
 
 	return gqlerrors.FormatError(wrapExtendedError(err, loc))
 }
+
+// ErrorPresenter formats errors sent to clients, e.g. to hide internal details of resolver errors
+type ErrorPresenter func(ctx context.Context, err error) gqlerrors.FormattedError
+
+// ExtensionCorrelationID is error extension key of correlation ID of errors masked by NewMaskingErrorPresenter
+const ExtensionCorrelationID = "correlationId"
+
+// MaskedErrorMessage is message of errors masked by NewMaskingErrorPresenter
+const MaskedErrorMessage = "internal server error"
+
+func defaultErrorPresenter(_ context.Context, err error) gqlerrors.FormattedError {
+	return FormatError(err)
+}
+
+// presentError formats error with ErrorPresenter of the server handling the request
+func presentError(ctx context.Context, err error) gqlerrors.FormattedError {
+	presenter, ok := ctx.Value(contextKeyErrorPresenter).(ErrorPresenter)
+	if !ok {
+		return FormatError(err)
+	}
+
+	return presenter(ctx, err)
+}
+
+func presentErrors(ctx context.Context, errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	if len(errs) == 0 {
+		return errs
+	}
+
+	res := make([]gqlerrors.FormattedError, 0, len(errs))
+
+	for _, err := range errs {
+		res = append(res, presentError(ctx, err))
+	}
+
+	return res
+}
+
+// NewMaskingErrorPresenter returns ErrorPresenter replacing message of internal errors with MaskedErrorMessage and
+// random correlation ID in ExtensionCorrelationID extension. Original error is passed to report together with the ID,
+// or logged with standard logger if report is nil.
+// Syntax and validation errors produced by graphql, protocol errors, errors with ErrorCode other than
+// INTERNAL_SERVER_ERROR and errors matching one of allowed with errors.Is are presented as is. Masked errors carry
+// INTERNAL_SERVER_ERROR code.
+func NewMaskingErrorPresenter(report func(ctx context.Context, id string, err error), allowed ...error) ErrorPresenter {
+	if report == nil {
+		report = func(_ context.Context, id string, err error) {
+			log.Printf("wsgraphql: error %s: %v", id, err)
+		}
+	}
+
+	return func(ctx context.Context, err error) gqlerrors.FormattedError {
+		fmterr := FormatError(err)
+
+		if maskingAllowed(internalError(err), allowed) {
+			return fmterr
+		}
+
+		var buf [16]byte
+
+		_, _ = rand.Read(buf[:])
+
+		id := hex.EncodeToString(buf[:])
+
+		report(ctx, id, err)
+
+		masked := gqlerrors.FormatError(&gqlerrors.Error{
+			Message:   MaskedErrorMessage,
+			Locations: fmterr.Locations,
+			Path:      fmterr.Path,
+		})
+
+		masked.Extensions = map[string]interface{}{
+			ExtensionCode:          string(ErrorCodeInternalServerError),
+			ExtensionCorrelationID: id,
+		}
+
+		return masked
+	}
+}
+
+// internalError returns error graphql error originates from, or nil if it was produced by graphql itself
+func internalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		case gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return err
+		}
+	}
+}
+
+func maskingAllowed(err error, allowed []error) bool {
+	if err == nil {
+		return true
+	}
+
+	var awerr apollows.Error
+
+	if errors.As(err, &awerr) {
+		return true
+	}
+
+	if code := ErrorCodeOf(err); code != "" && code != ErrorCodeInternalServerError {
+		return true
+	}
+
+	for _, a := range allowed {
+		if errors.Is(err, a) {
+			return true
+		}
+	}
+
+	return false
+}
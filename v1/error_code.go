@@ -0,0 +1,243 @@
+package wsgraphql
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// ExtensionCode is error extension key of ErrorCode
+const ExtensionCode = "code"
+
+// ErrorCode classifies errors sent to clients in ExtensionCode error extension
+type ErrorCode string
+
+const (
+	// ErrorCodeBadUserInput indicates invalid operation variables or arguments
+	ErrorCodeBadUserInput ErrorCode = "BAD_USER_INPUT"
+
+	// ErrorCodeUnauthenticated indicates missing or invalid credentials
+	ErrorCodeUnauthenticated ErrorCode = "UNAUTHENTICATED"
+
+	// ErrorCodeForbidden indicates insufficient permissions of authenticated client
+	ErrorCodeForbidden ErrorCode = "FORBIDDEN"
+
+	// ErrorCodePersistedQueryNotFound indicates persisted query hash unknown to the server
+	ErrorCodePersistedQueryNotFound ErrorCode = "PERSISTED_QUERY_NOT_FOUND"
+
+	// ErrorCodeInternalServerError indicates unexpected server failure
+	ErrorCodeInternalServerError ErrorCode = "INTERNAL_SERVER_ERROR"
+
+	// ErrorCodeGraphqlParseFailed indicates operation document syntax error, assigned by the server
+	ErrorCodeGraphqlParseFailed ErrorCode = "GRAPHQL_PARSE_FAILED"
+
+	// ErrorCodeGraphqlValidationFailed indicates operation document invalid against the schema, assigned by the server
+	ErrorCodeGraphqlValidationFailed ErrorCode = "GRAPHQL_VALIDATION_FAILED"
+)
+
+// HTTPStatus returns HTTP status of error response with the code. PERSISTED_QUERY_NOT_FOUND is reported with
+// 200 OK, as expected by automatic persisted queries clients; unknown codes are reported with 400 Bad Request.
+func (code ErrorCode) HTTPStatus() int {
+	switch code {
+	case ErrorCodeUnauthenticated:
+		return http.StatusUnauthorized
+	case ErrorCodeForbidden:
+		return http.StatusForbidden
+	case ErrorCodePersistedQueryNotFound:
+		return http.StatusOK
+	case ErrorCodeInternalServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// CloseCode returns websocket close code of connection initialization failing with the code
+func (code ErrorCode) CloseCode() apollows.MessageType {
+	switch code {
+	case ErrorCodeUnauthenticated:
+		return apollows.EventUnauthorized
+	case ErrorCodeForbidden:
+		return apollows.EventForbidden
+	case ErrorCodeInternalServerError:
+		return apollows.EventInternalServerError
+	default:
+		return apollows.EventInvalidMessage
+	}
+}
+
+// CodeError is error carrying ErrorCode in ExtensionCode extension
+type CodeError struct {
+	err  error
+	Code ErrorCode
+}
+
+// NewCodeError returns error with message and code
+func NewCodeError(code ErrorCode, message string) *CodeError {
+	return &CodeError{
+		err:  errors.New(message),
+		Code: code,
+	}
+}
+
+// WrapCodeError returns error wrapping err with code
+func WrapCodeError(code ErrorCode, err error) *CodeError {
+	return &CodeError{
+		err:  err,
+		Code: code,
+	}
+}
+
+// NewBadUserInputError returns error with message and BAD_USER_INPUT code
+func NewBadUserInputError(message string) *CodeError {
+	return NewCodeError(ErrorCodeBadUserInput, message)
+}
+
+// NewUnauthenticatedError returns error with message and UNAUTHENTICATED code
+func NewUnauthenticatedError(message string) *CodeError {
+	return NewCodeError(ErrorCodeUnauthenticated, message)
+}
+
+// NewForbiddenError returns error with message and FORBIDDEN code
+func NewForbiddenError(message string) *CodeError {
+	return NewCodeError(ErrorCodeForbidden, message)
+}
+
+// NewPersistedQueryNotFoundError returns PersistedQueryNotFound error with PERSISTED_QUERY_NOT_FOUND code
+func NewPersistedQueryNotFoundError() *CodeError {
+	return NewCodeError(ErrorCodePersistedQueryNotFound, "PersistedQueryNotFound")
+}
+
+// NewInternalServerError returns error with message and INTERNAL_SERVER_ERROR code
+func NewInternalServerError(message string) *CodeError {
+	return NewCodeError(ErrorCodeInternalServerError, message)
+}
+
+// Error implementation
+func (err *CodeError) Error() string {
+	return err.err.Error()
+}
+
+// Unwrap returns wrapped error
+func (err *CodeError) Unwrap() error {
+	return err.err
+}
+
+// Extensions implementation of gqlerrors.ExtendedError, keeping extensions of wrapped error
+func (err *CodeError) Extensions() map[string]interface{} {
+	res := make(map[string]interface{})
+
+	var ext gqlerrors.ExtendedError
+
+	if errors.As(err.err, &ext) {
+		for k, v := range ext.Extensions() {
+			res[k] = v
+		}
+	}
+
+	res[ExtensionCode] = string(err.Code)
+
+	return res
+}
+
+// ErrorCodeOf returns code of the error, or empty string if it carries none
+func ErrorCodeOf(err error) ErrorCode {
+	for err != nil {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			if code := extensionCode(e.Extensions); code != "" {
+				return code
+			}
+
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		case gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			var ext gqlerrors.ExtendedError
+
+			if errors.As(err, &ext) {
+				return extensionCode(ext.Extensions())
+			}
+
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func extensionCode(extensions map[string]interface{}) ErrorCode {
+	switch code := extensions[ExtensionCode].(type) {
+	case ErrorCode:
+		return code
+	case string:
+		return ErrorCode(code)
+	default:
+		return ""
+	}
+}
+
+// withErrorCode returns err with code assigned, unless it already carries one, keeping its locations and path
+func withErrorCode(err error, code ErrorCode) error {
+	if err == nil || ErrorCodeOf(err) != "" {
+		return err
+	}
+
+	fmterr := gqlerrors.FormatError(err)
+
+	original := fmterr.OriginalError()
+	if original == nil {
+		original = errors.New(fmterr.Message)
+	}
+
+	return &gqlerrors.Error{
+		Message:       fmterr.Message,
+		Locations:     fmterr.Locations,
+		Path:          fmterr.Path,
+		OriginalError: WrapCodeError(code, original),
+	}
+}
+
+// withErrorCodes assigns code to errors not carrying one
+func withErrorCodes(errs []gqlerrors.FormattedError, code ErrorCode) []gqlerrors.FormattedError {
+	if len(errs) == 0 {
+		return errs
+	}
+
+	res := make([]gqlerrors.FormattedError, 0, len(errs))
+
+	for _, err := range errs {
+		res = append(res, gqlerrors.FormatError(withErrorCode(err, code)))
+	}
+
+	return res
+}
+
+// closeError returns error with ErrorCode as apollows.Error, closing websocket with ErrorCode.CloseCode
+func closeError(err error) error {
+	if _, ok := err.(apollows.Error); ok {
+		return err
+	}
+
+	code := ErrorCodeOf(err)
+	if code == "" {
+		return err
+	}
+
+	return apollows.WrapError(err, code.CloseCode())
+}
+
+// errorsHTTPStatus returns HTTP status of error response with the errors, derived from the first error with code
+func errorsHTTPStatus(errs []gqlerrors.FormattedError) int {
+	for _, err := range errs {
+		if code := ErrorCodeOf(err); code != "" {
+			return code.HTTPStatus()
+		}
+	}
+
+	return http.StatusBadRequest
+}
@@ -0,0 +1,145 @@
+package wsgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", NewForbiddenError("no access"))
+
+	assert.Equal(t, ErrorCodeForbidden, ErrorCodeOf(err))
+	assert.Equal(t, ErrorCodeForbidden, ErrorCodeOf(FormatError(err)))
+	assert.Equal(t, ErrorCode(""), ErrorCodeOf(errors.New("plain")))
+
+	fmterr := FormatError(WrapCodeError(ErrorCodeBadUserInput, &extendedError{
+		error:      errors.New("invalid"),
+		extensions: map[string]interface{}{"foo": "bar"},
+	}))
+
+	assert.Equal(t, "invalid", fmterr.Message)
+	assert.Equal(t, map[string]interface{}{
+		"foo":         "bar",
+		ExtensionCode: "BAD_USER_INPUT",
+	}, fmterr.Extensions)
+
+	assert.Equal(t, http.StatusUnauthorized, ErrorCodeUnauthenticated.HTTPStatus())
+	assert.Equal(t, http.StatusOK, ErrorCodePersistedQueryNotFound.HTTPStatus())
+	assert.Equal(t, apollows.EventForbidden, ErrorCodeForbidden.CloseCode())
+}
+
+func TestErrorCodeHTTP(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS, WithExtraInterceptors(Interceptors{
+		Init: func(ctx context.Context, init apollows.PayloadInit, handler HandlerInit) error {
+			if ContextHTTPRequest(ctx).Header.Get("authorization") == "" {
+				return NewUnauthenticatedError("missing credentials")
+			}
+
+			return handler(ctx, init)
+		},
+	}))
+
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name          string
+		authorization string
+		body          string
+		status        int
+		code          ErrorCode
+	}{
+		{
+			name:   "unauthenticated",
+			body:   `{"query":"{ getFoo }"}`,
+			status: http.StatusUnauthorized,
+			code:   ErrorCodeUnauthenticated,
+		},
+		{
+			name:          "parse",
+			authorization: "user",
+			body:          `{"query":"{"}`,
+			status:        http.StatusBadRequest,
+			code:          ErrorCodeGraphqlParseFailed,
+		},
+		{
+			name:          "validation",
+			authorization: "user",
+			body:          `{"query":"{ unknown }"}`,
+			status:        http.StatusBadRequest,
+			code:          ErrorCodeGraphqlValidationFailed,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(c.body))
+
+			assert.NoError(t, err)
+
+			req.Header.Set("authorization", c.authorization)
+
+			resp, err := srv.Client().Do(req)
+
+			assert.NoError(t, err)
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			var res struct {
+				Errors []struct {
+					Extensions map[string]interface{} `json:"extensions"`
+					Message    string                 `json:"message"`
+				} `json:"errors"`
+			}
+
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, c.status, resp.StatusCode)
+
+			if assert.Len(t, res.Errors, 1) {
+				assert.EqualValues(t, c.code, res.Errors[0].Extensions[ExtensionCode])
+			}
+		})
+	}
+}
+
+func TestErrorCodeWebsocketInit(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS, WithExtraInterceptors(Interceptors{
+		Init: func(ctx context.Context, init apollows.PayloadInit, handler HandlerInit) error {
+			return NewForbiddenError("not allowed")
+		},
+	}))
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventForbidden)), "%v", err)
+	assert.Contains(t, err.Error(), "not allowed")
+}
@@ -0,0 +1,133 @@
+package wsgraphql
+
+import (
+	"context"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// ExecuteParams describes operation to be validated or executed by Executor
+type ExecuteParams struct {
+	// Document is parsed operation document, possibly rewritten by the server, e.g. for incremental delivery
+	Document *ast.Document
+	// Root is root object provided to root resolvers
+	Root map[string]interface{}
+	// Variables provided with the operation
+	Variables map[string]interface{}
+	// Query is operation source, empty if Document was rewritten by the server
+	Query string
+	// OperationName selects operation to execute from the document
+	OperationName string
+	// Subscription is true if operation is a subscription
+	Subscription bool
+}
+
+// Executor executes graphql operations parsed by the server, allowing to use graphql engines other than graphql-go.
+// Server parses operations with graphql-go parser to handle protocol features and extensions regardless of executor.
+type Executor interface {
+	// Validate returns validation errors of the operation, if any
+	Validate(ctx context.Context, params *ExecuteParams) []gqlerrors.FormattedError
+
+	// Execute executes the operation, returning channel of results, closed once execution is over.
+	// Subscriptions should be executed until ctx is done.
+	Execute(ctx context.Context, params *ExecuteParams) (chan *graphql.Result, error)
+}
+
+// NewSchemaExecutor returns default Executor, using graphql-go with provided schema
+func NewSchemaExecutor(schema graphql.Schema) Executor {
+	return &schemaExecutor{
+		schema: schema,
+	}
+}
+
+type schemaExecutor struct {
+	schema graphql.Schema
+}
+
+func (executor *schemaExecutor) Validate(_ context.Context, params *ExecuteParams) []gqlerrors.FormattedError {
+	result := graphql.ValidateDocument(&executor.schema, params.Document, nil)
+	if result.IsValid {
+		return nil
+	}
+
+	if len(result.Errors) == 0 {
+		return []gqlerrors.FormattedError{
+			gqlerrors.NewFormattedError("invalid document"),
+		}
+	}
+
+	return result.Errors
+}
+
+func (executor *schemaExecutor) Execute(ctx context.Context, params *ExecuteParams) (chan *graphql.Result, error) {
+	execParams := graphql.ExecuteParams{
+		Schema:        executor.schema,
+		Root:          params.Root,
+		AST:           params.Document,
+		OperationName: params.OperationName,
+		Args:          params.Variables,
+		Context:       ctx,
+	}
+
+	if params.Subscription {
+		return graphql.ExecuteSubscription(execParams), nil
+	}
+
+	cres := make(chan *graphql.Result, 1)
+	cres <- graphql.Execute(execParams)
+	close(cres)
+
+	return cres, nil
+}
+
+// executeParams returns ExecuteParams of parsed operation
+func (*serverImpl) executeParams(ctx context.Context, payload *apollows.PayloadOperation) *ExecuteParams {
+	return &ExecuteParams{
+		Document:      ContextAST(ctx),
+		Root:          contextRootObject(ctx),
+		Variables:     payload.Variables,
+		Query:         payload.Query,
+		OperationName: payload.OperationName,
+		Subscription:  ContextSubscription(ctx),
+	}
+}
+
+// contextRootObject returns root object selected for the operation during parsing
+func contextRootObject(ctx context.Context) map[string]interface{} {
+	rootObject, _ := ctx.Value(contextKeyRootObject).(map[string]interface{})
+
+	return rootObject
+}
+
+// executeOnce executes non-subscription operation, returning its single result
+func executeOnce(ctx context.Context, executor Executor, params *ExecuteParams) (result *graphql.Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &graphql.Result{
+				Errors: gqlerrors.FormatErrors(handlePanic(ctx, r)),
+			}
+		}
+	}()
+
+	cres, err := executor.Execute(ctx, params)
+	if err != nil {
+		return &graphql.Result{
+			Errors: gqlerrors.FormatErrors(err),
+		}
+	}
+
+	for res := range cres {
+		if result == nil {
+			result = res
+		}
+	}
+
+	if result == nil {
+		result = &graphql.Result{}
+	}
+
+	return result
+}
@@ -0,0 +1,422 @@
+package wsgraphql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// DirectiveDefer @defer directive definition, should be added to the schema directives to enable incremental
+// delivery of fragments, e.g.
+// Directives: append(graphql.SpecifiedDirectives, wsgraphql.DirectiveDefer)
+// Since graphql-go can not suspend execution, fragments of the root selection set are deferred only: each is executed
+// as a separate document selecting its root fields, concurrently with the initial one, so no resolver runs twice.
+// Fragments deferred within fields are delivered with the initial payload, as permitted by incremental delivery.
+// @stream is not supported, as graphql-go resolves lists in full.
+var DirectiveDefer = graphql.NewDirective(graphql.DirectiveConfig{
+	Name:        "defer",
+	Description: "Directs the executor to deliver this fragment in a subsequent incremental payload.",
+	Locations: []string{
+		graphql.DirectiveLocationFragmentSpread,
+		graphql.DirectiveLocationInlineFragment,
+	},
+	Args: graphql.FieldConfigArgument{
+		"if": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: true,
+			Description:  "Deferred when true.",
+		},
+		"label": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Identifies incremental payloads of this fragment.",
+		},
+	},
+})
+
+// extensionKeyIncremental is used to pass incremental delivery state along with graphql.Result through interceptors,
+// it is removed before result is written
+const extensionKeyIncremental = "wsgraphql.incremental"
+
+type incrementalMeta struct {
+	entries []incrementalEntry
+	hasNext bool
+}
+
+type incrementalEntry struct {
+	Data       interface{}                `json:"data,omitempty"`
+	Errors     []gqlerrors.FormattedError `json:"errors,omitempty"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+	Label      string                     `json:"label,omitempty"`
+	Path       []interface{}              `json:"path"`
+}
+
+type incrementalResult struct {
+	Data        interface{}                `json:"data,omitempty"`
+	Errors      []gqlerrors.FormattedError `json:"errors,omitempty"`
+	Extensions  map[string]interface{}     `json:"extensions,omitempty"`
+	Incremental []incrementalEntry         `json:"incremental,omitempty"`
+	HasNext     bool                       `json:"hasNext"`
+}
+
+// incrementalPayload returns value to be serialized for the result, which is either result itself or incremental
+// delivery payload
+func incrementalPayload(result *graphql.Result) interface{} {
+	meta, ok := result.Extensions[extensionKeyIncremental].(*incrementalMeta)
+	if !ok {
+		return result
+	}
+
+	exts := make(map[string]interface{}, len(result.Extensions))
+
+	for k, v := range result.Extensions {
+		if k != extensionKeyIncremental {
+			exts[k] = v
+		}
+	}
+
+	if len(exts) == 0 {
+		exts = nil
+	}
+
+	return &incrementalResult{
+		Data:        result.Data,
+		Errors:      result.Errors,
+		Extensions:  exts,
+		Incremental: meta.entries,
+		HasNext:     meta.hasNext,
+	}
+}
+
+func setIncrementalMeta(result *graphql.Result, meta *incrementalMeta) *graphql.Result {
+	if result.Extensions == nil {
+		result.Extensions = make(map[string]interface{})
+	}
+
+	result.Extensions[extensionKeyIncremental] = meta
+
+	return result
+}
+
+type incrementalDeferred struct {
+	doc   *ast.Document
+	label string
+}
+
+type incrementalPlan struct {
+	initial  *ast.Document
+	vars     map[string]interface{}
+	frags    map[string]*ast.FragmentDefinition
+	op       *ast.OperationDefinition
+	deferred []*incrementalDeferred
+}
+
+// newIncrementalPlan splits query operation of the document into the initial document, without deferred fragments,
+// and documents resolving each deferred fragment. Returns nil if operation does not defer fragments of the root
+// selection set.
+func newIncrementalPlan(
+	astdoc *ast.Document,
+	op *ast.OperationDefinition,
+	vars map[string]interface{},
+) *incrementalPlan {
+	if op == nil || op.Operation != ast.OperationTypeQuery {
+		return nil
+	}
+
+	plan := &incrementalPlan{
+		vars:  vars,
+		frags: make(map[string]*ast.FragmentDefinition),
+		op:    op,
+	}
+
+	for _, definition := range astdoc.Definitions {
+		frag, ok := definition.(*ast.FragmentDefinition)
+		if ok {
+			plan.frags[frag.Name.Value] = frag
+		}
+	}
+
+	set := plan.selectionSet(op.SelectionSet, nil, true)
+
+	if len(plan.deferred) == 0 {
+		return nil
+	}
+
+	plan.initial = plan.document(set)
+
+	return plan
+}
+
+func (plan *incrementalPlan) document(set *ast.SelectionSet) *ast.Document {
+	return ast.NewDocument(&ast.Document{
+		Definitions: []ast.Node{
+			ast.NewOperationDefinition(&ast.OperationDefinition{
+				Operation:           plan.op.Operation,
+				Name:                plan.op.Name,
+				VariableDefinitions: plan.op.VariableDefinitions,
+				Directives:          plan.op.Directives,
+				SelectionSet:        set,
+			}),
+		},
+	})
+}
+
+func (plan *incrementalPlan) argument(dir *ast.Directive, name string) interface{} {
+	for _, arg := range dir.Arguments {
+		if arg.Name == nil || arg.Name.Value != name {
+			continue
+		}
+
+		switch v := arg.Value.(type) {
+		case *ast.Variable:
+			return plan.vars[v.Name.Value]
+		case *ast.BooleanValue:
+			return v.Value
+		case *ast.StringValue:
+			return v.Value
+		}
+	}
+
+	return nil
+}
+
+// directive returns directive with given name, which is enabled by its "if" argument, and remaining directives
+func (plan *incrementalPlan) directive(dirs []*ast.Directive, name string) (res *ast.Directive, rest []*ast.Directive) {
+	for _, dir := range dirs {
+		if dir.Name == nil || dir.Name.Value != name {
+			rest = append(rest, dir)
+
+			continue
+		}
+
+		enabled, ok := plan.argument(dir, "if").(bool)
+		if !ok || enabled {
+			res = dir
+		}
+	}
+
+	return
+}
+
+// selectionSet returns copy of the selection set with fragment spreads inlined, and, when root is true, deferred
+// fragments removed and recorded into the plan.
+// chain holds copies of enclosing fragments of the root selection set, used to build documents for deferred fragments.
+func (plan *incrementalPlan) selectionSet(set *ast.SelectionSet, chain []ast.Selection, root bool) *ast.SelectionSet {
+	if set == nil {
+		return nil
+	}
+
+	res := ast.NewSelectionSet(&ast.SelectionSet{
+		Loc: set.Loc,
+	})
+
+	for _, sel := range set.Selections {
+		var nsel ast.Selection
+
+		switch sel := sel.(type) {
+		case *ast.Field:
+			nsel = plan.field(sel)
+		case *ast.InlineFragment:
+			nsel = plan.fragment(sel.TypeCondition, sel.Directives, sel.SelectionSet, chain, root)
+		case *ast.FragmentSpread:
+			frag, ok := plan.frags[sel.Name.Value]
+			if !ok {
+				continue
+			}
+
+			nsel = plan.fragment(frag.TypeCondition, sel.Directives, frag.SelectionSet, chain, root)
+		}
+
+		if nsel != nil {
+			res.Selections = append(res.Selections, nsel)
+		}
+	}
+
+	return res
+}
+
+// field returns copy of the field, fragments deferred within it are delivered with the enclosing payload
+func (plan *incrementalPlan) field(field *ast.Field) ast.Selection {
+	return ast.NewField(&ast.Field{
+		Loc:          field.Loc,
+		Alias:        field.Alias,
+		Name:         field.Name,
+		Arguments:    field.Arguments,
+		Directives:   field.Directives,
+		SelectionSet: plan.selectionSet(field.SelectionSet, nil, false),
+	})
+}
+
+func (plan *incrementalPlan) fragment(
+	cond *ast.Named,
+	directives []*ast.Directive,
+	set *ast.SelectionSet,
+	chain []ast.Selection,
+	root bool,
+) ast.Selection {
+	deferred, dirs := plan.directive(directives, DirectiveDefer.Name)
+
+	nfrag := ast.NewInlineFragment(&ast.InlineFragment{
+		TypeCondition: cond,
+		Directives:    dirs,
+	})
+
+	if deferred == nil || !root {
+		nchain := append(append([]ast.Selection{}, chain...), nfrag)
+
+		nfrag.SelectionSet = plan.selectionSet(set, nchain, root)
+
+		return nfrag
+	}
+
+	// nested deferred fragments are delivered along with enclosing deferred fragment
+	nfrag.SelectionSet = plan.selectionSet(set, nil, false)
+
+	var sel ast.Selection = nfrag
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		parent, ok := chain[i].(*ast.InlineFragment)
+		if !ok {
+			continue
+		}
+
+		nparent := *parent
+		nparent.SelectionSet = ast.NewSelectionSet(&ast.SelectionSet{
+			Selections: []ast.Selection{sel},
+		})
+		sel = &nparent
+	}
+
+	label, _ := plan.argument(deferred, "label").(string)
+
+	plan.deferred = append(plan.deferred, &incrementalDeferred{
+		doc: plan.document(ast.NewSelectionSet(&ast.SelectionSet{
+			Selections: []ast.Selection{sel},
+		})),
+		label: label,
+	})
+
+	return nil
+}
+
+// entries returns incremental payload of the deferred fragment, merged into the root of initial data
+func (deferred *incrementalDeferred) entries(result *graphql.Result) []incrementalEntry {
+	entry := incrementalEntry{
+		Errors:     result.Errors,
+		Extensions: result.Extensions,
+		Label:      deferred.label,
+		Path:       []interface{}{},
+	}
+
+	if data, ok := result.Data.(map[string]interface{}); ok && len(data) > 0 {
+		entry.Data = data
+	} else if !result.HasErrors() {
+		return nil
+	}
+
+	return []incrementalEntry{entry}
+}
+
+func acceptsMultipart(accept []string) bool {
+	for _, v := range accept {
+		if strings.Contains(v, "multipart/mixed") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// incrementalAllowed returns true if operation results may be delivered incrementally to the client, which is
+// supported by graphql-transport-ws and multipart/mixed HTTP responses only
+func incrementalAllowed(ctx context.Context) bool {
+	if ContextSubscription(ctx) || ContextBatchIndex(ctx) >= 0 {
+		return false
+	}
+
+	if ws := ContextWebsocketConnection(ctx); ws != nil {
+		protocol, _ := apollows.ParseSubprotocol(ws.Subprotocol())
+
+		return protocol == apollows.WebsocketSubprotocolGraphqlTransportWS
+	}
+
+	r := ContextHTTPRequest(ctx)
+
+	return r != nil && acceptsMultipart(r.Header.Values("accept"))
+}
+
+// executeIncremental executes initial document and deferred documents concurrently, delivering initial result
+// followed by incremental payloads in order of completion, see DirectiveDefer.
+func executeIncremental(
+	ctx context.Context,
+	executor Executor,
+	params *ExecuteParams,
+	plan *incrementalPlan,
+) chan *graphql.Result {
+	cres := make(chan *graphql.Result, 1)
+
+	go func() {
+		defer close(cres)
+
+		send := func(result *graphql.Result) bool {
+			select {
+			case cres <- result:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		completed := make(chan []incrementalEntry, len(plan.deferred))
+
+		for _, deferred := range plan.deferred {
+			p := *params
+			p.Document, p.Query = deferred.doc, ""
+
+			go func(deferred *incrementalDeferred, p *ExecuteParams) {
+				completed <- deferred.entries(executeOnce(ctx, executor, p))
+			}(deferred, &p)
+		}
+
+		p := *params
+		p.Document, p.Query = plan.initial, ""
+
+		result := executeOnce(ctx, executor, &p)
+
+		pending := len(plan.deferred)
+
+		if result.Data == nil {
+			pending = 0
+		}
+
+		if !send(setIncrementalMeta(result, &incrementalMeta{hasNext: pending > 0})) {
+			return
+		}
+
+		for ; pending > 0; pending-- {
+			var entries []incrementalEntry
+
+			select {
+			case entries = <-completed:
+			case <-ctx.Done():
+				return
+			}
+
+			if len(entries) == 0 && pending > 1 {
+				continue
+			}
+
+			if !send(setIncrementalMeta(&graphql.Result{}, &incrementalMeta{
+				entries: entries,
+				hasNext: pending > 1,
+			})) {
+				return
+			}
+		}
+	}()
+
+	return cres
+}
@@ -0,0 +1,477 @@
+package wsgraphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIncrementalQuery = `query Foo {
+	fast
+	... @defer(label: "slow") { slow }
+	obj { a ...ObjB @defer }
+}
+
+fragment ObjB on Obj { b }`
+
+func testNewIncrementalServer(t *testing.T) *httptest.Server {
+	obj := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Obj",
+		Fields: graphql.Fields{
+			"a": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return 1, nil
+				},
+			},
+			"b": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return 2, nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"fast": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 1, nil
+					},
+				},
+				"slow": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						time.Sleep(time.Millisecond * 50)
+
+						return 2, nil
+					},
+				},
+				"obj": &graphql.Field{
+					Type: obj,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return struct{}{}, nil
+					},
+				},
+				"failing": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, errors.New("failed")
+					},
+				},
+			},
+		}),
+		Directives: append(graphql.SpecifiedDirectives, DirectiveDefer),
+	})
+
+	assert.NoError(t, err)
+
+	server, err := NewServer(schema, WithUpgrader(testWrapper{
+		Upgrader: &websocket.Upgrader{
+			Subprotocols: []string{
+				apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+				apollows.WebsocketSubprotocolGraphqlWS.String(),
+			},
+		},
+	}))
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+// testIncrementalMerge applies incremental payloads onto the initial data
+func testIncrementalMerge(t *testing.T, pds []apollows.PayloadDataResponse) map[string]interface{} {
+	assert.NotEmpty(t, pds)
+
+	data := pds[0].Data
+
+	for i, pd := range pds {
+		assert.Equal(t, i < len(pds)-1, pd.HasNext)
+
+		for _, inc := range pd.Incremental {
+			var target interface{} = data
+
+			for _, key := range inc.Path {
+				switch key := key.(type) {
+				case string:
+					target = target.(map[string]interface{})[key]
+				case float64:
+					target = target.([]interface{})[int(key)]
+				}
+			}
+
+			for k, v := range inc.Data {
+				target.(map[string]interface{})[k] = v
+			}
+		}
+	}
+
+	return data
+}
+
+func TestIncrementalPlan(t *testing.T) {
+	astdoc, err := parser.Parse(parser.ParseParams{Source: testIncrementalQuery})
+
+	assert.NoError(t, err)
+
+	plan := newIncrementalPlan(astdoc, selectOperation(astdoc, ""), nil)
+
+	assert.NotNil(t, plan)
+	assert.Len(t, plan.deferred, 1)
+	assert.Equal(t, "slow", plan.deferred[0].label)
+
+	astdoc, err = parser.Parse(parser.ParseParams{Source: `query { obj { a ... @defer { b } } }`})
+
+	assert.NoError(t, err)
+	assert.Nil(t, newIncrementalPlan(astdoc, selectOperation(astdoc, ""), nil))
+
+	astdoc, err = parser.Parse(parser.ParseParams{Source: `query ($d: Boolean) { fast ... @defer(if: $d) { slow } }`})
+
+	assert.NoError(t, err)
+	assert.Nil(t, newIncrementalPlan(astdoc, selectOperation(astdoc, ""), map[string]interface{}{"d": false}))
+	assert.NotNil(t, newIncrementalPlan(astdoc, selectOperation(astdoc, ""), map[string]interface{}{"d": true}))
+
+	astdoc, err = parser.Parse(parser.ParseParams{Source: `query { fast }`})
+
+	assert.NoError(t, err)
+	assert.Nil(t, newIncrementalPlan(astdoc, selectOperation(astdoc, ""), nil))
+}
+
+func TestIncrementalWebsocket(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: testIncrementalQuery,
+			},
+		},
+	}))
+
+	var pds []apollows.PayloadDataResponse
+
+	for {
+		assert.NoError(t, conn.ReadJSON(&msg))
+
+		if msg.Type == apollows.OperationComplete {
+			break
+		}
+
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		pd, err := msg.Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+		assert.Empty(t, pd.Errors)
+
+		pds = append(pds, *pd)
+	}
+
+	assert.Greater(t, len(pds), 1)
+	assert.Equal(t, map[string]interface{}{
+		"fast": float64(1),
+		"obj": map[string]interface{}{
+			"a": float64(1),
+			"b": float64(2),
+		},
+	}, pds[0].Data)
+
+	assert.Equal(t, map[string]interface{}{
+		"fast": float64(1),
+		"slow": float64(2),
+		"obj": map[string]interface{}{
+			"a": float64(1),
+			"b": float64(2),
+		},
+	}, testIncrementalMerge(t, pds))
+}
+
+func TestIncrementalWebsocketPartialError(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { failing ... @defer { slow } }`,
+			},
+		},
+	}))
+
+	var pds []apollows.PayloadDataResponse
+
+	for {
+		assert.NoError(t, conn.ReadJSON(&msg))
+
+		if msg.Type == apollows.OperationComplete {
+			break
+		}
+
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		pd, err := msg.Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+
+		pds = append(pds, *pd)
+	}
+
+	if assert.Len(t, pds, 2) {
+		assert.Len(t, pds[0].Errors, 1)
+		assert.True(t, pds[0].HasNext)
+		assert.False(t, pds[1].HasNext)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"failing": nil,
+		"slow":    float64(2),
+	}, testIncrementalMerge(t, pds))
+}
+
+func TestIncrementalWebsocketLegacy(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationStart,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: testIncrementalQuery,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationData, msg.Type)
+
+	pd, err := msg.Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.Empty(t, pd.Errors)
+	assert.Empty(t, pd.Incremental)
+	assert.False(t, pd.HasNext)
+	assert.Equal(t, map[string]interface{}{
+		"fast": float64(1),
+		"slow": float64(2),
+		"obj": map[string]interface{}{
+			"a": float64(1),
+			"b": float64(2),
+		},
+	}, pd.Data)
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+}
+
+func TestIncrementalStreamRejected(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: `query { fast @stream }`,
+	})
+
+	assert.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Nil(t, pd.Data)
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, string(ErrorCodeGraphqlValidationFailed), pd.Errors[0].Extensions["code"])
+	}
+}
+
+func TestIncrementalPlainMultipart(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: testIncrementalQuery,
+	})
+
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("accept", "multipart/mixed, application/json")
+
+	resp, err := srv.Client().Do(req)
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	mediatype, params, err := mime.ParseMediaType(resp.Header.Get("content-type"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediatype)
+
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+
+	var pds []apollows.PayloadDataResponse
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json; charset=utf-8", part.Header.Get("content-type"))
+
+		var pd apollows.PayloadDataResponse
+
+		assert.NoError(t, json.NewDecoder(part).Decode(&pd))
+
+		pds = append(pds, pd)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"fast": float64(1),
+		"slow": float64(2),
+		"obj": map[string]interface{}{
+			"a": float64(1),
+			"b": float64(2),
+		},
+	}, testIncrementalMerge(t, pds))
+}
+
+func TestIncrementalPlainEager(t *testing.T) {
+	srv := testNewIncrementalServer(t)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: testIncrementalQuery,
+	})
+
+	assert.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Empty(t, pd.Errors)
+	assert.False(t, pd.HasNext)
+	assert.Equal(t, map[string]interface{}{
+		"fast": float64(1),
+		"slow": float64(2),
+		"obj": map[string]interface{}{
+			"a": float64(1),
+			"b": float64(2),
+		},
+	}, pd.Data)
+}
@@ -0,0 +1,83 @@
+package wsgraphql
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// WebsocketObserver receives events of websocket connection for instrumentation purposes. Observers are registered for
+// the request with ObserveWebsocket, typically by HTTPRequest interceptors. Methods are called synchronously by
+// connection reader and writer and should not block.
+type WebsocketObserver interface {
+	// WebsocketConnected is called once websocket connection is established with negotiated subprotocol
+	WebsocketConnected(ctx context.Context, subprotocol string)
+
+	// WebsocketMessageReceived is called for each message read from the connection, size is 0 for connections
+	// decoding messages themselves, not implementing FrameConn
+	WebsocketMessageReceived(ctx context.Context, operation apollows.Operation, size int)
+
+	// WebsocketMessageSent is called for each message written to the connection, with operation context for messages
+	// of operations, size as in WebsocketMessageReceived and number of messages still waiting to be written to the
+	// connection, including ones of operations blocked until the connection is writable
+	WebsocketMessageSent(ctx context.Context, operation apollows.Operation, size, queued int)
+
+	// WebsocketClosed is called once connection is over, with close code and reason sent by the server, or 0 and
+	// empty reason if connection was closed by the client or lost
+	WebsocketClosed(ctx context.Context, code int, reason string)
+}
+
+// ObserveWebsocket registers observer for websocket connection served for the request, should be called before the
+// connection is established, e.g. by HTTPRequest interceptor before calling the handler
+func ObserveWebsocket(ctx context.Context, observer WebsocketObserver) {
+	reqctx := RequestContext(ctx)
+
+	observers := contextWebsocketObservers(reqctx)
+
+	reqctx.Set(contextKeyWebsocketObservers, append(observers[:len(observers):len(observers)], observer))
+}
+
+func contextWebsocketObservers(ctx context.Context) []WebsocketObserver {
+	observers, _ := ctx.Value(contextKeyWebsocketObservers).([]WebsocketObserver)
+
+	return observers
+}
+
+func (req *websocketRequest) observeConnected() {
+	req.observers = contextWebsocketObservers(req.ctx)
+
+	for _, observer := range req.observers {
+		observer.WebsocketConnected(req.ctx, req.ws.Subprotocol())
+	}
+}
+
+func (req *websocketRequest) observeReceived(operation apollows.Operation, size int) {
+	for _, observer := range req.observers {
+		observer.WebsocketMessageReceived(req.ctx, operation, size)
+	}
+}
+
+func (req *websocketRequest) observeSent(msg outgoingMessage, size int) {
+	if len(req.observers) == 0 || msg.Message == nil {
+		return
+	}
+
+	ctx := msg.ctx
+	if ctx == nil {
+		ctx = req.ctx
+	}
+
+	for _, observer := range req.observers {
+		observer.WebsocketMessageSent(ctx, msg.Type, size, int(atomic.LoadInt32(&req.queued)))
+	}
+}
+
+func (req *websocketRequest) observeClosed() {
+	code := int(atomic.LoadInt32(&req.closeCode))
+	reason, _ := req.closeReason.Load().(string)
+
+	for _, observer := range req.observers {
+		observer.WebsocketClosed(req.ctx, code, reason)
+	}
+}
@@ -0,0 +1,76 @@
+package wsgraphql
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+type testObserver struct {
+	subprotocol string
+	received    []apollows.Operation
+	sent        []apollows.Operation
+	closed      int
+	m           sync.Mutex
+}
+
+func (observer *testObserver) WebsocketConnected(_ context.Context, subprotocol string) {
+	observer.m.Lock()
+	defer observer.m.Unlock()
+
+	observer.subprotocol = subprotocol
+}
+
+func (observer *testObserver) WebsocketMessageReceived(_ context.Context, operation apollows.Operation, _ int) {
+	observer.m.Lock()
+	defer observer.m.Unlock()
+
+	observer.received = append(observer.received, operation)
+}
+
+func (observer *testObserver) WebsocketMessageSent(_ context.Context, operation apollows.Operation, _, _ int) {
+	observer.m.Lock()
+	defer observer.m.Unlock()
+
+	observer.sent = append(observer.sent, operation)
+}
+
+func (observer *testObserver) WebsocketClosed(context.Context, int, string) {
+	observer.m.Lock()
+	defer observer.m.Unlock()
+
+	observer.closed++
+}
+
+func TestObserveWebsocket(t *testing.T) {
+	observer := &testObserver{}
+
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithInterceptors(Interceptors{
+		HTTPRequest: func(ctx context.Context, w http.ResponseWriter, r *http.Request, handler HandlerHTTPRequest) error {
+			ObserveWebsocket(ctx, observer)
+
+			return handler(ctx, w, r)
+		},
+	}))
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+
+	assert.Eventually(t, func() bool {
+		observer.m.Lock()
+		defer observer.m.Unlock()
+
+		return observer.closed == 1
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, apollows.WebsocketSubprotocolGraphqlWS.String(), observer.subprotocol)
+	assert.Contains(t, observer.received, apollows.OperationConnectionInit)
+	assert.Contains(t, observer.sent, apollows.OperationConnectionAck)
+	assert.Contains(t, observer.sent, apollows.OperationData)
+}
@@ -0,0 +1,64 @@
+package wsgraphql
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// PanicError is error of operation recovered from panic
+type PanicError struct {
+	// Value passed to panic
+	Value interface{}
+	// Stack of the panicking goroutine
+	Stack []byte
+}
+
+// Error implementation
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// Unwrap returns panic value if it is an error
+func (err *PanicError) Unwrap() error {
+	e, _ := err.Value.(error)
+
+	return e
+}
+
+// PanicHandler is called with panic recovered during operation handling, returned error is reported as the operation
+// error, or PanicError itself if nil is returned. Other operations of the connection are not affected.
+type PanicHandler func(ctx context.Context, err *PanicError) error
+
+func defaultPanicHandler(_ context.Context, err *PanicError) error {
+	log.Printf("wsgraphql: %v\n%s", err, err.Stack)
+
+	return err
+}
+
+// recoverPanic reports recovered panic as operation error, to be deferred
+func recoverPanic(ctx context.Context, err *error) {
+	if r := recover(); r != nil {
+		*err = handlePanic(ctx, r)
+	}
+}
+
+// handlePanic passes recovered panic value to PanicHandler of the server handling the request
+func handlePanic(ctx context.Context, value interface{}) error {
+	perr := &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+
+	handler, ok := ctx.Value(contextKeyPanicHandler).(PanicHandler)
+	if !ok {
+		return perr
+	}
+
+	if err := handler(ctx, perr); err != nil {
+		return err
+	}
+
+	return perr
+}
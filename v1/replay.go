@@ -0,0 +1,303 @@
+package wsgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+const (
+	// ExtensionEventID result extension key used to report subscription event ID
+	ExtensionEventID = "eventId"
+
+	// ExtensionLastEventID operation extension key used by client to resume subscription after given event ID
+	ExtensionLastEventID = "lastEventId"
+
+	// HeaderLastEventID HTTP header used by client to resume plain HTTP subscription after given event ID
+	HeaderLastEventID = "Last-Event-ID"
+)
+
+// ReplayBuffer keeps bounded per-topic history of published subscription events, assigning monotonically increasing
+// event IDs to them. Subscribers resuming with last event ID (see ContextLastEventID) receive missed events still
+// present in the history before live ones.
+// Results produced from events delivered by ReplayBuffer carry event ID in ExtensionEventID result extension.
+// Topics are kept until removed with Remove.
+type ReplayBuffer struct {
+	topics map[string]*replayTopic
+	size   int
+	m      sync.Mutex
+}
+
+type replayEvent struct {
+	value interface{}
+	id    uint64
+}
+
+type replayTopic struct {
+	subscribers map[*replaySubscriber]struct{}
+	events      []replayEvent
+	lastID      uint64
+}
+
+type replaySubscriber struct {
+	notify  chan struct{}
+	removed chan struct{}
+	pending []replayEvent
+}
+
+// NewReplayBuffer returns new ReplayBuffer instance, keeping up to size most recent events per topic
+func NewReplayBuffer(size int) *ReplayBuffer {
+	if size < 1 {
+		size = 1
+	}
+
+	return &ReplayBuffer{
+		topics: make(map[string]*replayTopic),
+		size:   size,
+	}
+}
+
+func (buf *ReplayBuffer) topic(name string) *replayTopic {
+	t, ok := buf.topics[name]
+	if !ok {
+		t = &replayTopic{
+			subscribers: make(map[*replaySubscriber]struct{}),
+		}
+
+		buf.topics[name] = t
+	}
+
+	return t
+}
+
+// Publish appends value to the topic history and delivers it to the active subscribers, returning assigned event ID
+func (buf *ReplayBuffer) Publish(topic string, value interface{}) uint64 {
+	buf.m.Lock()
+	defer buf.m.Unlock()
+
+	t := buf.topic(topic)
+
+	t.lastID++
+
+	ev := replayEvent{
+		value: value,
+		id:    t.lastID,
+	}
+
+	t.events = append(t.events, ev)
+
+	if len(t.events) > buf.size {
+		t.events = t.events[len(t.events)-buf.size:]
+	}
+
+	for sub := range t.subscribers {
+		// slow subscriber loses oldest pending events, which is observable by a gap in event IDs
+		if len(sub.pending) >= buf.size {
+			sub.pending = sub.pending[1:]
+		}
+
+		sub.pending = append(sub.pending, ev)
+
+		select {
+		case sub.notify <- struct{}{}:
+		default:
+		}
+	}
+
+	return ev.id
+}
+
+// Remove drops history and event ID counter of the topic, completing its active subscriptions. Event IDs of the
+// topic published afterwards start over, so it should only be removed once its events are no longer of interest,
+// e.g. when entity the topic tracks is deleted.
+func (buf *ReplayBuffer) Remove(topic string) {
+	buf.m.Lock()
+	defer buf.m.Unlock()
+
+	t, ok := buf.topics[topic]
+	if !ok {
+		return
+	}
+
+	delete(buf.topics, topic)
+
+	for sub := range t.subscribers {
+		close(sub.removed)
+	}
+
+	t.subscribers = nil
+}
+
+// LastEventID returns ID of the most recently published event in the topic, or 0 if there were none
+func (buf *ReplayBuffer) LastEventID(topic string) uint64 {
+	buf.m.Lock()
+	defer buf.m.Unlock()
+
+	t, ok := buf.topics[topic]
+	if !ok {
+		return 0
+	}
+
+	return t.lastID
+}
+
+// Subscribe returns channel suitable to be returned from graphql.Field Subscribe function, delivering topic events
+// published after the subscription, preceded by the events in history following ContextLastEventID, if present.
+// Channel is closed once ctx is done.
+func (buf *ReplayBuffer) Subscribe(ctx context.Context, topic string) chan interface{} {
+	sub := &replaySubscriber{
+		notify:  make(chan struct{}, 1),
+		removed: make(chan struct{}),
+	}
+
+	buf.m.Lock()
+
+	t := buf.topic(topic)
+
+	lastID, err := strconv.ParseUint(ContextLastEventID(ctx), 10, 64)
+	if err == nil {
+		for _, ev := range t.events {
+			if ev.id > lastID {
+				sub.pending = append(sub.pending, ev)
+			}
+		}
+	}
+
+	t.subscribers[sub] = struct{}{}
+
+	buf.m.Unlock()
+
+	ch := make(chan interface{})
+
+	go buf.serve(ctx, t, sub, ch)
+
+	return ch
+}
+
+func (buf *ReplayBuffer) serve(ctx context.Context, t *replayTopic, sub *replaySubscriber, ch chan interface{}) {
+	defer func() {
+		buf.m.Lock()
+		delete(t.subscribers, sub)
+		buf.m.Unlock()
+
+		close(ch)
+	}()
+
+	cursor := contextEventCursor(ctx)
+
+	for {
+		buf.m.Lock()
+		events := sub.pending
+		sub.pending = nil
+		buf.m.Unlock()
+
+		for _, ev := range events {
+			cursor.push(ev.id)
+
+			select {
+			case ch <- ev.value:
+			case <-sub.removed:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-sub.notify:
+		case <-sub.removed:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// eventCursor tracks IDs of events handed to subscription executor; since events are executed sequentially, results
+// are produced in the same order as IDs are pushed
+type eventCursor struct {
+	ids []uint64
+	m   sync.Mutex
+}
+
+func (cursor *eventCursor) push(id uint64) {
+	if cursor == nil {
+		return
+	}
+
+	cursor.m.Lock()
+	cursor.ids = append(cursor.ids, id)
+	cursor.m.Unlock()
+}
+
+func (cursor *eventCursor) pop() (id uint64, ok bool) {
+	if cursor == nil {
+		return 0, false
+	}
+
+	cursor.m.Lock()
+	defer cursor.m.Unlock()
+
+	if len(cursor.ids) == 0 {
+		return 0, false
+	}
+
+	id = cursor.ids[0]
+	cursor.ids = cursor.ids[1:]
+
+	return id, true
+}
+
+func contextEventCursor(ctx context.Context) *eventCursor {
+	v := ctx.Value(contextKeyEventCursor)
+	if v == nil {
+		return nil
+	}
+
+	cursor, ok := v.(*eventCursor)
+	if !ok {
+		return nil
+	}
+
+	return cursor
+}
+
+// lastEventIDInvalid is message of error returned for numeric lastEventId extension not representing an event ID
+const lastEventIDInvalid = ExtensionLastEventID + " must be a non-negative integer"
+
+// lastEventID returns event ID client requested to resume after, rejecting numbers not representing an event ID
+func lastEventID(ctx context.Context, payload *apollows.PayloadOperation) (string, error) {
+	switch v := payload.Extensions[ExtensionLastEventID].(type) {
+	case string:
+		return v, nil
+	case float64:
+		// negated comparison rejects NaN as well
+		if !(v >= 0 && v < math.MaxUint64 && v == math.Trunc(v)) {
+			return "", NewBadUserInputError(lastEventIDInvalid)
+		}
+
+		return strconv.FormatUint(uint64(v), 10), nil
+	case json.Number:
+		_, err := strconv.ParseUint(v.String(), 10, 64)
+		if err != nil {
+			return "", NewBadUserInputError(lastEventIDInvalid)
+		}
+
+		return v.String(), nil
+	}
+
+	if ContextWebsocketConnection(ctx) != nil {
+		return "", nil
+	}
+
+	r := ContextHTTPRequest(ctx)
+	if r == nil {
+		return "", nil
+	}
+
+	return r.Header.Get(HeaderLastEventID), nil
+}
@@ -0,0 +1,305 @@
+package wsgraphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewReplayServer(t *testing.T, buf *ReplayBuffer) *httptest.Server {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"fooUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						return buf.Subscribe(p.Context, "foo"), nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	server, err := NewServer(schema, WithUpgrader(testWrapper{
+		Upgrader: &websocket.Upgrader{
+			Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+		},
+	}))
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func TestReplayBuffer(t *testing.T) {
+	buf := NewReplayBuffer(2)
+
+	assert.EqualValues(t, 1, buf.Publish("foo", 1))
+	assert.EqualValues(t, 2, buf.Publish("foo", 2))
+	assert.EqualValues(t, 3, buf.Publish("foo", 3))
+	assert.EqualValues(t, 1, buf.Publish("bar", 1))
+	assert.EqualValues(t, 3, buf.LastEventID("foo"))
+	assert.EqualValues(t, 0, buf.LastEventID("baz"))
+
+	opctx := mutable.NewMutableContext(context.Background())
+	opctx.Set(ContextKeyLastEventID, "1")
+	opctx.Set(contextKeyEventCursor, &eventCursor{})
+
+	ch := buf.Subscribe(opctx, "foo")
+
+	// event 1 is requested to be skipped, event 2 is still in history
+	assert.Equal(t, 2, <-ch)
+	assert.Equal(t, 3, <-ch)
+
+	buf.Publish("foo", 4)
+
+	assert.Equal(t, 4, <-ch)
+
+	cursor := contextEventCursor(opctx)
+
+	for _, expected := range []uint64{2, 3, 4} {
+		id, ok := cursor.pop()
+
+		assert.True(t, ok)
+		assert.Equal(t, expected, id)
+	}
+
+	opctx.Cancel()
+
+	_, ok := <-ch
+
+	assert.False(t, ok)
+}
+
+func TestReplayBufferRemove(t *testing.T) {
+	buf := NewReplayBuffer(2)
+
+	buf.Publish("foo", 1)
+
+	opctx := mutable.NewMutableContext(context.Background())
+
+	defer opctx.Cancel()
+
+	ch := buf.Subscribe(opctx, "foo")
+
+	buf.Remove("foo")
+
+	_, ok := <-ch
+
+	assert.False(t, ok)
+	assert.EqualValues(t, 0, buf.LastEventID("foo"))
+	assert.Empty(t, buf.topics)
+
+	buf.Remove("bar")
+
+	assert.EqualValues(t, 1, buf.Publish("foo", 2))
+}
+
+func TestReplayBufferWebsocket(t *testing.T) {
+	buf := NewReplayBuffer(10)
+
+	buf.Publish("foo", 1)
+	buf.Publish("foo", 2)
+	buf.Publish("foo", 3)
+
+	srv := testNewReplayServer(t, buf)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+				Extensions: map[string]interface{}{
+					ExtensionLastEventID: "1",
+				},
+			},
+		},
+	}))
+
+	for _, expected := range []int{2, 3, 4} {
+		if expected == 4 {
+			buf.Publish("foo", 4)
+		}
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		var pd struct {
+			Data       map[string]interface{} `json:"data"`
+			Extensions map[string]interface{} `json:"extensions"`
+		}
+
+		assert.NoError(t, json.Unmarshal(msg.Payload.RawMessage, &pd))
+		assert.EqualValues(t, expected, pd.Data["fooUpdates"])
+		assert.Equal(t, strconv.Itoa(expected), pd.Extensions[ExtensionEventID])
+	}
+}
+
+func TestReplayBufferPlain(t *testing.T) {
+	buf := NewReplayBuffer(10)
+
+	buf.Publish("foo", 1)
+	buf.Publish("foo", 2)
+
+	srv := testNewReplayServer(t, buf)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: `subscription { fooUpdates }`,
+	})
+
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	req.Header.Set(HeaderLastEventID, "1")
+
+	resp, err := srv.Client().Do(req)
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	assert.True(t, scanner.Scan())
+
+	var pd struct {
+		Data       map[string]interface{} `json:"data"`
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+
+	assert.NoError(t, json.Unmarshal(scanner.Bytes(), &pd))
+	assert.EqualValues(t, 2, pd.Data["fooUpdates"])
+	assert.Equal(t, "2", pd.Extensions[ExtensionEventID])
+}
+
+func TestReplayLastEventID(t *testing.T) {
+	for _, v := range []interface{}{float64(3), json.Number("3"), "3"} {
+		id, err := lastEventID(context.Background(), &apollows.PayloadOperation{
+			Extensions: map[string]interface{}{
+				ExtensionLastEventID: v,
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "3", id)
+	}
+
+	for _, v := range []interface{}{
+		float64(-1),
+		1.5,
+		math.NaN(),
+		math.Inf(1),
+		math.Inf(-1),
+		1e20,
+		json.Number("-1"),
+		json.Number("1.5"),
+	} {
+		_, err := lastEventID(context.Background(), &apollows.PayloadOperation{
+			Extensions: map[string]interface{}{
+				ExtensionLastEventID: v,
+			},
+		})
+
+		var codeErr *CodeError
+
+		if assert.ErrorAs(t, err, &codeErr, "%v", v) {
+			assert.Equal(t, ErrorCodeBadUserInput, codeErr.Code)
+		}
+	}
+}
+
+func TestReplayLastEventIDRejected(t *testing.T) {
+	buf := NewReplayBuffer(10)
+
+	srv := testNewReplayServer(t, buf)
+
+	defer srv.Close()
+
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: `subscription { fooUpdates }`,
+		Extensions: map[string]interface{}{
+			ExtensionLastEventID: -1,
+		},
+	})
+
+	assert.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL, "application/json", bytes.NewReader(bs))
+
+	assert.NoError(t, err)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, string(ErrorCodeBadUserInput), pd.Errors[0].Extensions["code"])
+	}
+}
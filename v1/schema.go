@@ -0,0 +1,161 @@
+package wsgraphql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+// schemaStateIDs is source of schema state identifiers, unique across servers
+var schemaStateIDs uint64
+
+// schemaState is immutable snapshot of schema, executor and root object, captured by each operation during parsing,
+// so operations in flight are unaffected by SetSchema and SetExecutor
+type schemaState struct {
+	executor   Executor
+	rootObject map[string]interface{}
+	schema     graphql.Schema
+	id         uint64
+	// connection is true if state was selected for the connection by SchemaResolver
+	connection bool
+}
+
+func newSchemaState(schema graphql.Schema, executor Executor, rootObject map[string]interface{}) *schemaState {
+	return &schemaState{
+		executor:   executor,
+		rootObject: rootObject,
+		schema:     schema,
+		id:         atomic.AddUint64(&schemaStateIDs, 1),
+	}
+}
+
+// schemaSubscriptions tracks active subscriptions to revalidate once schema is replaced, see WithSchemaRevalidation
+type schemaSubscriptions struct {
+	operations map[mutable.Context]*apollows.PayloadOperation
+	m          sync.Mutex
+}
+
+// SetSchema implementation
+func (server *serverImpl) SetSchema(schema graphql.Schema) {
+	server.storeSchemaState(schema, server.schemaExecutor(schema))
+}
+
+// schemaExecutor returns default executor for the schema, with extensions of the server added to a copy of the schema
+func (server *serverImpl) schemaExecutor(schema graphql.Schema) Executor {
+	// execution hooks and results are handled by graphql-go itself
+	if len(server.extensions) > 0 {
+		schema.AddExtensions(server.extensions...)
+	}
+
+	return NewSchemaExecutor(schema)
+}
+
+// SetExecutor implementation
+func (server *serverImpl) SetExecutor(executor Executor) {
+	server.storeSchemaState(server.loadSchemaState().schema, executor)
+}
+
+func (server *serverImpl) storeSchemaState(schema graphql.Schema, executor Executor) {
+	state := newSchemaState(schema, executor, server.rootObject)
+
+	server.state.Store(state)
+
+	if server.subscriptions == nil {
+		return
+	}
+
+	server.subscriptions.m.Lock()
+
+	operations := make(map[mutable.Context]*apollows.PayloadOperation, len(server.subscriptions.operations))
+
+	for opctx, payload := range server.subscriptions.operations {
+		operations[opctx] = payload
+	}
+
+	server.subscriptions.m.Unlock()
+
+	for opctx, payload := range operations {
+		server.revalidate(opctx, payload, state)
+	}
+}
+
+func (server *serverImpl) loadSchemaState() *schemaState {
+	state, _ := server.state.Load().(*schemaState)
+
+	return state
+}
+
+// operationSchemaState returns schema state captured by the operation or selected for the connection, or current one
+// if there is none
+func (server *serverImpl) operationSchemaState(ctx context.Context) *schemaState {
+	if state, ok := ctx.Value(contextKeySchemaState).(*schemaState); ok {
+		return state
+	}
+
+	return server.loadSchemaState()
+}
+
+// trackSubscription registers parsed subscription for revalidation, returned function unregisters it
+func (server *serverImpl) trackSubscription(ctx context.Context, payload *apollows.PayloadOperation) func() {
+	if server.subscriptions == nil || !ContextSubscription(ctx) || server.operationSchemaState(ctx).connection {
+		return func() {}
+	}
+
+	opctx := OperationContext(ctx)
+
+	server.subscriptions.m.Lock()
+	server.subscriptions.operations[opctx] = payload
+	server.subscriptions.m.Unlock()
+
+	// schema may have been replaced after the operation was parsed, but before it was registered
+	if state := server.loadSchemaState(); state != server.operationSchemaState(ctx) {
+		server.revalidate(opctx, payload, state)
+	}
+
+	return func() {
+		server.subscriptions.m.Lock()
+		delete(server.subscriptions.operations, opctx)
+		server.subscriptions.m.Unlock()
+	}
+}
+
+// revalidate completes subscription if its document is no longer valid against given schema state
+func (server *serverImpl) revalidate(opctx mutable.Context, payload *apollows.PayloadOperation, state *schemaState) {
+	errs := state.executor.Validate(opctx, server.executeParams(opctx, payload))
+	if len(errs) == 0 {
+		return
+	}
+
+	opctx.Cancel()
+}
+
+// schemaSharedKey scopes shared execution key to the schema state, so subscriptions parsed after schema was
+// replaced do not join executions started with another one
+func schemaSharedKey(state *schemaState, key string) string {
+	return strconv.FormatUint(state.id, 10) + ":" + key
+}
+
+// resolveSchema selects schema state for the connection using SchemaResolver, if any
+func (server *serverImpl) resolveSchema(ctx context.Context, init apollows.PayloadInit) error {
+	if server.schemaResolver == nil {
+		return nil
+	}
+
+	schema, rootObject, err := server.schemaResolver(ctx, init)
+	if err != nil {
+		return err
+	}
+
+	state := newSchemaState(schema, server.schemaExecutor(schema), rootObject)
+
+	state.connection = true
+
+	RequestContext(ctx).Set(contextKeySchemaState, state)
+
+	return nil
+}
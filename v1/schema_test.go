@@ -0,0 +1,315 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSchemaReplacement(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getBar": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 456, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"barUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						return make(chan interface{}), nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func testSchemaServer(t *testing.T, topics *testSharedTopics, opts ...ServerOption) (Server, *httptest.Server) {
+	server, err := NewServer(topics.schema(t), append([]ServerOption{
+		WithUpgrader(testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{
+					apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+				},
+			},
+		}),
+	}, opts...)...)
+
+	assert.NoError(t, err)
+
+	return server, httptest.NewServer(server)
+}
+
+func testSchemaQuery(t *testing.T, srv *httptest.Server, query string) string {
+	resp, err := srv.Client().Post(srv.URL, "application/json", strings.NewReader(`{"query":"`+query+`"}`))
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	bs, err := io.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+
+	return string(bs)
+}
+
+func testSchemaSubscribed(topics *testSharedTopics) func() bool {
+	return func() bool {
+		topics.m.Lock()
+		defer topics.m.Unlock()
+
+		return len(topics.channels["foo"]) == 1
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	server, srv := testSchemaServer(t, topics)
+
+	defer srv.Close()
+
+	conn := testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo")
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	assert.Eventually(t, testSchemaSubscribed(topics), time.Second, time.Millisecond)
+
+	assert.Contains(t, testSchemaQuery(t, srv, "query { getFoo }"), `"getFoo":123`)
+
+	server.SetSchema(testSchemaReplacement(t))
+
+	assert.Contains(t, testSchemaQuery(t, srv, "query { getBar }"), `"getBar":456`)
+	assert.Contains(t, testSchemaQuery(t, srv, "query { getFoo }"), `"errors"`)
+
+	topics.publish("foo", 1)
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	pd, err := msg.Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, pd.Data["topic"])
+}
+
+func TestSetSchemaRevalidation(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	server, srv := testSchemaServer(t, topics, WithSchemaRevalidation())
+
+	defer srv.Close()
+
+	conn := testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo")
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	assert.Eventually(t, testSchemaSubscribed(topics), time.Second, time.Millisecond)
+
+	// schema still valid for the subscription
+	server.SetSchema(topics.schema(t))
+
+	topics.publish("foo", 1)
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	server.SetSchema(testSchemaReplacement(t))
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+
+	assert.Eventually(t, func() bool {
+		topics.m.Lock()
+		defer topics.m.Unlock()
+
+		return len(topics.channels["foo"]) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestSetExecutor(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	server, srv := testSchemaServer(t, topics)
+
+	defer srv.Close()
+
+	executor := &testExecutor{
+		Executor: NewSchemaExecutor(testSchemaReplacement(t)),
+	}
+
+	server.SetExecutor(executor)
+
+	assert.Contains(t, testSchemaQuery(t, srv, "query { getBar }"), `"getBar":456`)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&executor.executes))
+}
+
+func testSchemaInit(t *testing.T, srv *httptest.Server, init apollows.PayloadInit) *websocket.Conn {
+	dialer := websocket.Dialer{
+		Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	}
+
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+		Payload: apollows.Data{
+			Value: init,
+		},
+	}))
+
+	return conn
+}
+
+func TestWithSchemaResolver(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	schemas := map[string]graphql.Schema{
+		"foo": topics.schema(t),
+		"bar": testSchemaReplacement(t),
+	}
+
+	rootObject := map[string]interface{}{
+		"tenant": "bar",
+	}
+
+	var requests int64
+
+	_, srv := testSchemaServer(t, topics, WithSchemaResolver(func(
+		ctx context.Context,
+		init apollows.PayloadInit,
+	) (graphql.Schema, map[string]interface{}, error) {
+		tenant, _ := init["tenant"].(string)
+
+		if r := ContextHTTPRequest(ctx); init == nil && r != nil {
+			atomic.AddInt64(&requests, 1)
+
+			tenant = r.Header.Get("x-tenant")
+		}
+
+		schema, ok := schemas[tenant]
+		if !ok {
+			return graphql.Schema{}, nil, errors.New("unknown tenant")
+		}
+
+		return schema, rootObject, nil
+	}), WithInterceptors(Interceptors{
+		OperationParse: func(ctx context.Context, payload *apollows.PayloadOperation, handler HandlerOperationParse) error {
+			err := handler(ctx, payload)
+
+			assert.Equal(t, rootObject, ContextOperationParams(ctx).RootObject)
+
+			return err
+		},
+	}))
+
+	defer srv.Close()
+
+	conn := testSchemaInit(t, srv, apollows.PayloadInit{"tenant": "bar"})
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getBar }`,
+			},
+		},
+	}))
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+
+	pd, err := msg.Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 456, pd.Data["getBar"])
+
+	unknown := testSchemaInit(t, srv, apollows.PayloadInit{"tenant": "baz"})
+
+	defer func() {
+		_ = unknown.Close()
+	}()
+
+	msg = apollows.Message{}
+
+	assert.NoError(t, unknown.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationError, msg.Type)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"query":"query { getFoo }"}`))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("x-tenant", "foo")
+
+	resp, err := srv.Client().Do(req)
+
+	assert.NoError(t, err)
+
+	bs, err := io.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Contains(t, string(bs), `"getFoo":123`)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&requests))
+}
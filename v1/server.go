@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/graphql-go/graphql/gqlerrors"
@@ -13,30 +15,53 @@ import (
 	"github.com/graphql-go/graphql"
 )
 
-var (
-	errHTTPQueryRejected = errors.New("HTTP query rejected")
-	errReflectExtensions = errors.New("could not reflect schema extensions")
-)
+var errHTTPQueryRejected = errors.New("HTTP query rejected")
 
 type serverConfig struct {
 	upgrader              Upgrader
 	interceptors          Interceptors
 	resultProcessor       ResultProcessor
+	errorPresenter        ErrorPresenter
+	panicHandler          PanicHandler
+	executor              Executor
+	schemaResolver        SchemaResolver
 	rootObject            map[string]interface{}
+	rootObjectProvider    RootObjectProvider
+	variablesCoercer      VariablesCoercer
 	subscriptionProtocols map[apollows.Protocol]struct{}
+	codecs                map[string]apollows.Codec
+	jsonCodec             apollows.JSONCodec
+	extraExtensions       []graphql.Extension
 	keepalive             time.Duration
 	connectTimeout        time.Duration
+	eventTimeout          time.Duration
+	uploadMaxMemory       int64
+	uploadMaxFileSize     int64
+	uploadMaxRequestSize  int64
+	batchMaxSize          int
+	batchParallelism      int
 	rejectHTTPQueries     bool
+	batching              bool
+	uploads               bool
+	eventDriven           bool
+	sharedSubscriptions   bool
+	schemaRevalidation    bool
 }
 
 type serverImpl struct {
-	extensions []graphql.Extension
-	schema     graphql.Schema
+	state         atomic.Value
+	shared        *sharedSubscriptions
+	subscriptions *schemaSubscriptions
+	extensions    []graphql.Extension
 	serverConfig
 }
 
+func (server *serverImpl) isWebsocketRequest(r *http.Request) bool {
+	return r.Header.Get("connection") != "" && r.Header.Get("upgrade") != "" && server.upgrader != nil
+}
+
 func (server *serverImpl) handleHTTPRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (err error) {
-	if r.Header.Get("connection") != "" && r.Header.Get("upgrade") != "" && server.upgrader != nil {
+	if server.isWebsocketRequest(r) {
 		err = server.serveWebsocketRequest(ctx, w, r)
 	} else {
 		err = server.servePlainRequest(ctx)
@@ -46,25 +71,72 @@ func (server *serverImpl) handleHTTPRequest(ctx context.Context, w http.Response
 }
 
 func (server *serverImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	reqctx := mutable.NewMutableContext(r.Context())
+	var (
+		parent context.Context = r.Context()
+		cancel context.CancelFunc
+	)
+
+	// event-driven websocket connections outlive the handler, which cancels HTTP request context upon return
+	if server.eventDriven && server.isWebsocketRequest(r) {
+		parent, cancel = context.WithCancel(detachedContext{
+			Context: parent,
+		})
+	}
+
+	reqctx := mutable.NewMutableContext(parent)
+
+	// HTTP request context cancellation is propagated unless connection was taken over by event-driven handling
+	if cancel != nil {
+		go func() {
+			<-r.Context().Done()
+
+			if !contextDetached(reqctx) {
+				cancel()
+			}
+		}()
+	}
 
 	reqctx.Set(ContextKeyRequestContext, reqctx)
 	reqctx.Set(ContextKeyHTTPRequest, r)
 	reqctx.Set(ContextKeyHTTPResponseWriter, w)
+	reqctx.Set(contextKeyErrorPresenter, server.errorPresenter)
+	reqctx.Set(contextKeyPanicHandler, server.panicHandler)
+	reqctx.Set(ContextKeyJSONCodec, server.jsonCodec)
 
 	_ = server.interceptors.HTTPRequest(reqctx, w, r, server.handleHTTPRequest)
 
-	reqctx.Cancel()
+	// request context of event-driven connection is cancelled once the connection is done
+	if !contextDetached(reqctx) {
+		reqctx.Cancel()
+	}
+}
+
+// serveOperation handles operation with interceptors, reporting panics as the operation error
+func (server *serverImpl) serveOperation(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	handler HandlerOperation,
+) (err error) {
+	defer recoverPanic(ctx, &err)
+
+	return server.interceptors.Operation(ctx, payload, handler)
 }
 
 func (server *serverImpl) processResults(
 	ctx context.Context,
 	payload *apollows.PayloadOperation,
 	cres chan *graphql.Result,
-	write func(ctx context.Context, result *graphql.Result) error,
+	write func(ctx context.Context, result interface{}) error,
 ) (err error) {
 	OperationContext(ctx).Set(ContextKeyOperationExecuted, true)
 
+	// results are already being delivered, panic is delivered as an error result
+	defer func() {
+		if r := recover(); r != nil {
+			err = server.processPanic(ctx, r, write)
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -78,9 +150,19 @@ func (server *serverImpl) processResults(
 				return
 			}
 
-			err = server.processResult(ctx, payload, result, write)
-			if err != nil {
-				return err
+			resulterr := server.processResult(ctx, payload, result, write)
+
+			var reserr ResultError
+
+			// errors of incremental payload do not end delivery of the remaining ones
+			if ContextIncremental(ctx) && errors.As(resulterr, &reserr) {
+				err = resulterr
+
+				continue
+			}
+
+			if resulterr != nil {
+				return resulterr
 			}
 		}
 	}
@@ -90,7 +172,7 @@ func (server *serverImpl) processResult(
 	ctx context.Context,
 	payload *apollows.PayloadOperation,
 	result *graphql.Result,
-	write func(ctx context.Context, result *graphql.Result) error,
+	write func(ctx context.Context, result interface{}) error,
 ) error {
 	result = server.resultProcessor(ctx, payload, result)
 
@@ -98,25 +180,51 @@ func (server *serverImpl) processResult(
 
 	err, ok := result.Data.(error)
 	if ok {
-		tgterrs = append(tgterrs, FormatError(err))
+		tgterrs = append(tgterrs, presentError(ctx, err))
 	}
 
 	for _, src := range result.Errors {
-		tgterrs = append(tgterrs, FormatError(src))
+		tgterrs = append(tgterrs, presentError(ctx, src))
 	}
 
 	result.Errors = tgterrs
 
-	err = write(ctx, result)
+	if id, ok := contextEventCursor(ctx).pop(); ok {
+		if result.Extensions == nil {
+			result.Extensions = make(map[string]interface{})
+		}
+
+		result.Extensions[ExtensionEventID] = strconv.FormatUint(id, 10)
+	}
+
+	err = write(ctx, incrementalPayload(result))
 	if err != nil {
 		return err
 	}
 
 	if result.HasErrors() {
-		return ResultError{
-			Result: result,
-		}
+		return server.resultError(result)
 	}
 
 	return nil
 }
+
+// processPanic writes error result of panic recovered while processing results
+func (server *serverImpl) processPanic(
+	ctx context.Context,
+	value interface{},
+	write func(ctx context.Context, result interface{}) error,
+) error {
+	result := &graphql.Result{
+		Errors: []gqlerrors.FormattedError{
+			presentError(ctx, handlePanic(ctx, value)),
+		},
+	}
+
+	err := write(ctx, result)
+	if err != nil {
+		return err
+	}
+
+	return server.resultError(result)
+}
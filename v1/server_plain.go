@@ -1,69 +1,122 @@
 package wsgraphql
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 
 	"github.com/eientei/wsgraphql/v1/apollows"
 	"github.com/eientei/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
 )
 
+// multipartBoundary is used to separate incremental delivery payloads in multipart/mixed HTTP responses
+const multipartBoundary = "-"
+
 // ResultError passes error result as error
 type ResultError struct {
 	*graphql.Result
+
+	// json encodes the result, encoding/json is used if nil
+	json apollows.JSONMarshaler
 }
 
 // Error implementation
 func (r ResultError) Error() string {
-	bs, _ := json.Marshal(r.Result)
+	var (
+		bs  []byte
+		err error
+	)
+
+	if r.json != nil {
+		bs, err = r.json.Marshal(r.Result)
+	} else {
+		bs, err = json.Marshal(r.Result)
+	}
+
+	if err != nil {
+		return err.Error()
+	}
 
 	return string(bs)
 }
 
+// resultError returns result as error, encoded with JSON codec of the server
+func (server *serverImpl) resultError(result *graphql.Result) ResultError {
+	return ResultError{
+		Result: result,
+		json:   server.jsonCodec,
+	}
+}
+
 func (server *serverImpl) operationExecute(
 	ctx context.Context,
 	payload *apollows.PayloadOperation,
 ) (cres chan *graphql.Result, err error) {
-	subscription := ContextSubscription(ctx)
+	defer recoverPanic(ctx, &err)
+
 	astdoc := ContextAST(ctx)
+	execctx := server.executionContext(ctx)
 
-	if subscription {
-		cres = graphql.ExecuteSubscription(graphql.ExecuteParams{
-			Schema:        server.schema,
-			Root:          server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       ctx,
-		})
-	} else {
-		cres = make(chan *graphql.Result, 1)
-		cres <- graphql.Execute(graphql.ExecuteParams{
-			Schema:        server.schema,
-			Root:          server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       ctx,
-		})
-		close(cres)
+	var plan *incrementalPlan
+
+	if incrementalAllowed(ctx) {
+		plan = newIncrementalPlan(astdoc, ContextOperationDefinition(ctx), payload.Variables)
 	}
 
-	return
+	executor := server.operationSchemaState(ctx).executor
+	params := server.executeParams(ctx, payload)
+
+	if plan != nil {
+		OperationContext(ctx).Set(ContextKeyIncremental, true)
+
+		return executeIncremental(execctx, executor, params, plan), nil
+	}
+
+	return executor.Execute(execctx, params)
 }
 
 func (server *serverImpl) operationParse(
 	ctx context.Context,
 	payload *apollows.PayloadOperation,
 ) (err error) {
+	defer recoverPanic(ctx, &err)
+
+	if server.variablesCoercer != nil {
+		payload.Variables, err = server.variablesCoercer(ctx, payload)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = server.parseAST(ctx, payload)
 	if err != nil {
 		return err
 	}
 
+	opctx := OperationContext(ctx)
+
+	lastID, err := lastEventID(ctx, payload)
+	if err != nil {
+		return server.resultError(&graphql.Result{
+			Errors: []gqlerrors.FormattedError{
+				FormatError(err),
+			},
+		})
+	}
+
+	opctx.Set(ContextKeyLastEventID, lastID)
+
+	if ContextSubscription(ctx) {
+		opctx.Set(contextKeyEventCursor, &eventCursor{})
+	}
+
 	return
 }
 
@@ -76,6 +129,8 @@ func (server *serverImpl) plainRequestOperation(
 		return err
 	}
 
+	defer server.trackSubscription(ctx, payload)()
+
 	w := ContextHTTPResponseWriter(ctx)
 
 	w.Header().Set("content-type", "application/json")
@@ -91,13 +146,31 @@ func (server *serverImpl) plainRequestOperation(
 
 	var flusher http.Flusher
 
-	if ContextSubscription(ctx) {
+	if ContextSubscription(ctx) || ContextIncremental(ctx) {
 		flusher, _ = w.(http.Flusher)
 		w.Header().Set("x-content-type-options", "nosniff")
 		w.Header().Set("connection", "keep-alive")
 	}
 
-	return server.processResults(ctx, payload, cres, func(ctx context.Context, result *graphql.Result) error {
+	if ContextIncremental(ctx) {
+		mw := multipart.NewWriter(w)
+
+		_ = mw.SetBoundary(multipartBoundary)
+
+		w.Header().Set("content-type", `multipart/mixed; boundary="`+multipartBoundary+`"`)
+
+		defer func() {
+			if ContextHTTPResponseStarted(ctx) {
+				_ = mw.Close()
+			}
+		}()
+
+		return server.processResults(ctx, payload, cres, func(ctx context.Context, result interface{}) error {
+			return server.writeMultipartResult(ctx, result, mw, flusher)
+		})
+	}
+
+	return server.processResults(ctx, payload, cres, func(ctx context.Context, result interface{}) error {
 		return server.writePlainResult(ctx, result, w, flusher)
 	})
 }
@@ -116,9 +189,43 @@ func (server *serverImpl) servePlainRequest(reqctx context.Context) (err error)
 		return err
 	}
 
+	err = server.resolveSchema(reqctx, nil)
+	if err != nil {
+		return err
+	}
+
+	r := ContextHTTPRequest(reqctx)
+
+	var (
+		body    *bufio.Reader
+		uploads *uploadForm
+	)
+
+	if isMultipartForm(r) {
+		uploads, err = server.readUploadForm(reqctx, r)
+		if err != nil {
+			return
+		}
+
+		defer uploads.cleanup()
+
+		body = bufio.NewReader(bytes.NewReader(uploads.operations))
+	} else {
+		body = bufio.NewReader(r.Body)
+	}
+
+	if isJSONArray(body) {
+		return server.serveBatchRequest(reqctx, body, uploads)
+	}
+
 	var payload apollows.PayloadOperation
 
-	err = json.NewDecoder(ContextHTTPRequest(reqctx).Body).Decode(&payload)
+	err = server.jsonCodec.NewDecoder(body).Decode(&payload)
+	if err != nil {
+		return
+	}
+
+	err = uploads.inject(&payload, "")
 	if err != nil {
 		return
 	}
@@ -128,12 +235,39 @@ func (server *serverImpl) servePlainRequest(reqctx context.Context) (err error)
 
 	defer opctx.Cancel()
 
-	return server.interceptors.Operation(opctx, &payload, server.plainRequestOperation)
+	return server.serveOperation(opctx, &payload, server.plainRequestOperation)
+}
+
+func (server *serverImpl) writeMultipartResult(
+	reqctx context.Context,
+	result interface{},
+	mw *multipart.Writer,
+	flusher http.Flusher,
+) (err error) {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": []string{"application/json; charset=utf-8"},
+	})
+	if err != nil {
+		return
+	}
+
+	err = server.jsonCodec.NewEncoder(part).Encode(result)
+	if err != nil {
+		return
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	RequestContext(reqctx).Set(ContextKeyHTTPResponseStarted, true)
+
+	return nil
 }
 
 func (server *serverImpl) writePlainResult(
 	reqctx context.Context,
-	result *graphql.Result,
+	result interface{},
 	w http.ResponseWriter,
 	flusher http.Flusher,
 ) (err error) {
@@ -141,7 +275,7 @@ func (server *serverImpl) writePlainResult(
 		return nil
 	}
 
-	bs, err := json.Marshal(result)
+	bs, err := server.jsonCodec.Marshal(result)
 	if err != nil {
 		return
 	}
@@ -4,31 +4,48 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/eientei/wsgraphql/v1/apollows"
 	"github.com/eientei/wsgraphql/v1/mutable"
-	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/graphql/gqlerrors"
 )
 
 type websocketRequest struct {
-	ctx        context.Context
-	outgoing   chan outgoingMessage
-	operations map[string]mutable.Context
-	ws         Conn
-	server     *serverImpl
-	protocol   apollows.Protocol
-	wg         sync.WaitGroup
-	m          sync.RWMutex
-	init       bool
+	ctx               context.Context
+	outgoing          chan outgoingMessage
+	operations        map[string]mutable.Context
+	ws                Conn
+	frames            FrameConn
+	polling           PollingConn
+	codec             apollows.Codec
+	server            *serverImpl
+	observers         []WebsocketObserver
+	connectSuccessful chan struct{}
+	connectTimer      *time.Timer
+	protocol          apollows.Protocol
+	wg                sync.WaitGroup
+	m                 sync.RWMutex
+	wm                sync.Mutex
+	closeReason       atomic.Value
+	closeCode         int32
+	queued            int32
+	init              bool
 }
 
 type outgoingMessage struct {
 	*apollows.Message
 	apollows.Error
+
+	// ctx is context of the operation message belongs to, if any
+	ctx context.Context
+
+	// encoded is pre-encoded JSON payload of the Message
+	encoded []byte
 }
 
 func (server *serverImpl) serveWebsocketRequest(
@@ -36,19 +53,34 @@ func (server *serverImpl) serveWebsocketRequest(
 	w http.ResponseWriter,
 	r *http.Request,
 ) (err error) {
-	ws, err := server.upgrader.Upgrade(w, r, w.Header())
+	reqctx := RequestContext(ctx)
+
+	reqctx.Set(ContextKeySubprotocols, server.subprotocols())
+
+	ws, err := server.upgrader.Upgrade(w, r.WithContext(ctx), w.Header())
 	if err != nil {
 		return
 	}
 
-	reqctx := RequestContext(ctx)
-
 	reqctx.Set(ContextKeyWebsocketConnection, ws)
 	reqctx.Set(ContextKeyHTTPResponseStarted, true)
 
-	protocol := apollows.Protocol(ws.Subprotocol())
+	protocol, codecName := apollows.ParseSubprotocol(ws.Subprotocol())
 
 	_, known := server.subscriptionProtocols[protocol]
+
+	codec := server.codecs[codecName]
+	frames, _ := ws.(FrameConn)
+
+	switch {
+	case codecName != "":
+		known = known && codec != nil && frames != nil
+	case frames != nil:
+		codec = apollows.JSONMessageCodec{
+			JSON: server.jsonCodec,
+		}
+	}
+
 	if !known {
 		if ws != nil {
 			_ = ws.Close(int(apollows.EventCloseNormal), apollows.ErrUnknownProtocol.Error())
@@ -60,21 +92,25 @@ func (server *serverImpl) serveWebsocketRequest(
 	req := &websocketRequest{
 		protocol:   protocol,
 		ctx:        ctx,
-		outgoing:   make(chan outgoingMessage, 1),
 		operations: make(map[string]mutable.Context),
 		ws:         ws,
+		frames:     frames,
+		codec:      codec,
 		server:     server,
 	}
 
-	var tickerType apollows.Operation
+	req.observeConnected()
 
-	switch req.protocol {
-	case apollows.WebsocketSubprotocolGraphqlWS:
-		tickerType = apollows.OperationKeepAlive
-	case apollows.WebsocketSubprotocolGraphqlTransportWS:
-		tickerType = apollows.OperationPong
+	if pc, ok := ws.(PollingConn); ok && server.eventDriven {
+		req.serveEventDriven(pc)
+
+		return
 	}
 
+	defer req.observeClosed()
+
+	req.outgoing = make(chan outgoingMessage, 1)
+
 	var tickerch <-chan time.Time
 
 	if server.keepalive > 0 {
@@ -98,25 +134,186 @@ func (server *serverImpl) serveWebsocketRequest(
 				return
 			}
 
-			switch {
-			case msg.Message != nil:
-				err = ws.WriteJSON(msg.Message)
-			case msg.Error != nil:
-				err = ws.Close(int(msg.Error.EventMessageType()), msg.Error.Error())
-			}
+			atomic.AddInt32(&req.queued, -1)
+
+			req.write(msg)
 		case <-tickerch:
-			err = ws.WriteJSON(&apollows.Message{
-				Type: tickerType,
-			})
+			req.write(req.keepaliveMessage())
+		}
+	}
+}
+
+// write sends message to the websocket, closing it on failure
+func (req *websocketRequest) write(msg outgoingMessage) {
+	var (
+		err  error
+		size int
+	)
+
+	_, plain := req.codec.(apollows.JSONMessageCodec)
+
+	// payload is encoded with JSON codec of the server, as encoding/json is used by apollows.Message.MarshalJSON
+	if msg.Message != nil && msg.encoded == nil && msg.Payload.Value != nil && (plain || req.codec == nil) {
+		msg.encoded, err = req.server.jsonCodec.Marshal(msg.Payload.Value)
+	}
+
+	if err == nil && msg.encoded != nil && !plain {
+		msg.Message.Payload.Value = json.RawMessage(msg.encoded)
+	}
+
+	switch {
+	case err != nil:
+	case msg.encoded != nil && plain:
+		var frame []byte
+
+		frame, err = req.encodeFrame(msg)
+		if err == nil {
+			size, err = len(frame), req.frames.WriteMessage(TextMessage, frame)
+		}
+	case msg.Message != nil && req.codec != nil:
+		var data []byte
+
+		data, err = req.codec.Marshal(msg.Message)
+		if err == nil {
+			size, err = len(data), req.frames.WriteMessage(req.messageType(), data)
+		}
+	case msg.Message != nil:
+		err = req.ws.WriteJSON(msg.Message)
+	case msg.Error != nil:
+		req.closeReason.Store(msg.Error.Error())
+		atomic.StoreInt32(&req.closeCode, int32(msg.Error.EventMessageType()))
+
+		err = req.ws.Close(int(msg.Error.EventMessageType()), msg.Error.Error())
+	}
+
+	if err != nil {
+		if atomic.CompareAndSwapInt32(&req.closeCode, 0, int32(apollows.EventCloseNormal)) {
+			req.closeReason.Store(err.Error())
 		}
 
+		_ = req.ws.Close(int(apollows.EventCloseNormal), err.Error())
+
+		return
+	}
+
+	req.observeSent(msg, size)
+}
+
+// encodeFrame encodes message with pre-encoded payload as JSON, without re-encoding the payload
+func (req *websocketRequest) encodeFrame(msg outgoingMessage) ([]byte, error) {
+	frame := make([]byte, 0, len(msg.encoded)+len(msg.ID)+32)
+
+	frame = append(frame, '{')
+
+	if msg.ID != "" {
+		id, err := req.server.jsonCodec.Marshal(msg.ID)
 		if err != nil {
-			_ = ws.Close(int(apollows.EventCloseNormal), err.Error())
+			return nil, err
+		}
+
+		frame = append(frame, `"id":`...)
+		frame = append(frame, id...)
+		frame = append(frame, ',')
+	}
+
+	frame = append(frame, `"type":"`...)
+	frame = append(frame, msg.Type...)
+	frame = append(frame, `","payload":`...)
+	frame = append(frame, msg.encoded...)
+	frame = append(frame, '}')
+
+	return frame, nil
+}
+
+// read reads next message from the websocket, decoding it with negotiated codec if any
+func (req *websocketRequest) read(msg *apollows.Message) error {
+	if req.codec == nil {
+		err := req.ws.ReadJSON(msg)
+		if err == nil {
+			req.observeReceived(msg.Type, 0)
 		}
+
+		return err
+	}
+
+	_, data, err := req.frames.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	err = req.codec.Unmarshal(data, msg)
+	if err == nil {
+		req.observeReceived(msg.Type, len(data))
+	}
+
+	return err
+}
+
+func (req *websocketRequest) messageType() int {
+	if req.codec.Binary() {
+		return BinaryMessage
 	}
+
+	return TextMessage
 }
 
-func combineErrors(errs []gqlerrors.FormattedError) gqlerrors.FormattedError {
+// send passes message to the writer loop, giving up once done is closed, or writes it directly in event-driven mode
+func (req *websocketRequest) send(done <-chan struct{}, msg outgoingMessage) {
+	atomic.AddInt32(&req.queued, 1)
+
+	if req.outgoing == nil {
+		req.wm.Lock()
+		atomic.AddInt32(&req.queued, -1)
+		req.writeEvent(msg)
+		req.wm.Unlock()
+
+		return
+	}
+
+	select {
+	case req.outgoing <- msg:
+	case <-done:
+		atomic.AddInt32(&req.queued, -1)
+	}
+}
+
+func (req *websocketRequest) keepaliveMessage() outgoingMessage {
+	var t apollows.Operation
+
+	switch req.protocol {
+	case apollows.WebsocketSubprotocolGraphqlWS:
+		t = apollows.OperationKeepAlive
+	case apollows.WebsocketSubprotocolGraphqlTransportWS:
+		t = apollows.OperationPong
+	}
+
+	return outgoingMessage{
+		Message: &apollows.Message{
+			Type: t,
+		},
+	}
+}
+
+// subprotocols returns sorted names of configured subscription protocols and their codec variants
+func (server *serverImpl) subprotocols() []string {
+	protocols := make([]string, 0, len(server.subscriptionProtocols))
+
+	for protocol := range server.subscriptionProtocols {
+		protocols = append(protocols, protocol.String())
+
+		for _, codec := range server.codecs {
+			protocols = append(protocols, protocol.Variant(codec))
+		}
+	}
+
+	sort.Strings(protocols)
+
+	return protocols
+}
+
+func combineErrors(ctx context.Context, errs []gqlerrors.FormattedError) gqlerrors.FormattedError {
+	errs = presentErrors(ctx, errs)
+
 	if len(errs) == 1 {
 		return errs[0]
 	}
@@ -158,13 +355,13 @@ func (req *websocketRequest) handleError(ctx context.Context, err error) {
 			req.writeWebsocketMessage(
 				ctx,
 				apollows.OperationConnectionError,
-				gqlerrors.FormatError(awerr),
+				presentError(ctx, awerr),
 			)
 		}
 
-		req.outgoing <- outgoingMessage{
+		req.send(nil, outgoingMessage{
 			Error: awerr,
-		}
+		})
 
 		return
 	}
@@ -174,20 +371,19 @@ func (req *websocketRequest) handleError(ctx context.Context, err error) {
 	if ok {
 		switch {
 		case req.protocol == apollows.WebsocketSubprotocolGraphqlWS:
-			req.writeWebsocketMessage(ctx, apollows.OperationError, combineErrors(res.Result.Errors))
+			req.writeWebsocketMessage(ctx, apollows.OperationError, combineErrors(ctx, res.Result.Errors))
 		default:
-			req.writeWebsocketMessage(ctx, apollows.OperationError, res.Result.Errors)
+			req.writeWebsocketMessage(ctx, apollows.OperationError, presentErrors(ctx, res.Result.Errors))
 		}
 
 		return
 	}
 
-	req.writeWebsocketMessage(ctx, apollows.OperationError, gqlerrors.FormatError(err))
+	req.writeWebsocketMessage(ctx, apollows.OperationError, presentError(ctx, err))
 }
 
-func (req *websocketRequest) writeWebsocketData(ctx context.Context, data *graphql.Result) {
-	var t apollows.Operation
-
+// dataOperation returns message type for operation results, false if results are no longer to be sent
+func (req *websocketRequest) dataOperation(ctx context.Context) (t apollows.Operation, ok bool) {
 	switch req.protocol {
 	case apollows.WebsocketSubprotocolGraphqlWS:
 		t = apollows.OperationData
@@ -195,20 +391,44 @@ func (req *websocketRequest) writeWebsocketData(ctx context.Context, data *graph
 		t = apollows.OperationNext
 
 		if ContextOperationStopped(ctx) {
-			return
+			return t, false
 		}
 	}
 
+	return t, true
+}
+
+func (req *websocketRequest) writeWebsocketData(ctx context.Context, data interface{}) {
+	t, ok := req.dataOperation(ctx)
+	if !ok {
+		return
+	}
+
 	req.writeWebsocketMessage(ctx, t, data)
 }
 
+func (req *websocketRequest) writeWebsocketEncoded(ctx context.Context, encoded []byte) {
+	t, ok := req.dataOperation(ctx)
+	if !ok {
+		return
+	}
+
+	req.send(RequestContext(ctx).Done(), outgoingMessage{
+		Message: &apollows.Message{
+			ID:   ContextOperationID(ctx),
+			Type: t,
+		},
+		ctx:     ctx,
+		encoded: encoded,
+	})
+}
+
 func (req *websocketRequest) writeWebsocketMessage(ctx context.Context, t apollows.Operation, data interface{}) {
 	if t == apollows.OperationError {
 		OperationContext(ctx).Set(ContextKeyOperationStopped, true)
 	}
 
-	select {
-	case req.outgoing <- outgoingMessage{
+	req.send(RequestContext(ctx).Done(), outgoingMessage{
 		Message: &apollows.Message{
 			ID:   ContextOperationID(ctx),
 			Type: t,
@@ -216,16 +436,15 @@ func (req *websocketRequest) writeWebsocketMessage(ctx context.Context, t apollo
 				Value: data,
 			},
 		},
-	}:
-	case <-RequestContext(ctx).Done():
-	}
+		ctx: ctx,
+	})
 }
 
 func (req *websocketRequest) readWebsocketInit(msg *apollows.Message) (err error) {
 	init := make(apollows.PayloadInit)
 
 	if len(msg.Payload.RawMessage) > 0 {
-		err = json.Unmarshal(msg.Payload.RawMessage, &init)
+		err = req.server.jsonCodec.Unmarshal(msg.Payload.RawMessage, &init)
 		if err != nil {
 			return
 		}
@@ -237,7 +456,12 @@ func (req *websocketRequest) readWebsocketInit(msg *apollows.Message) (err error
 		return nil
 	})
 	if err != nil {
-		return
+		return closeError(err)
+	}
+
+	err = req.server.resolveSchema(req.ctx, init)
+	if err != nil {
+		return closeError(err)
 	}
 
 	req.writeWebsocketMessage(req.ctx, apollows.OperationConnectionAck, nil)
@@ -272,13 +496,13 @@ func (req *websocketRequest) readWebsocketStart(msg *apollows.Message) (err erro
 	go func() {
 		var payload apollows.PayloadOperation
 
-		operr := json.Unmarshal(msg.Payload.RawMessage, &payload)
+		operr := req.server.jsonCodec.Unmarshal(msg.Payload.RawMessage, &payload)
 		if operr != nil {
 			if req.protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
 				operr = apollows.WrapError(operr, apollows.EventInvalidMessage)
 			}
 		} else {
-			operr = req.server.interceptors.Operation(opctx, &payload, req.serveWebsocketOperation)
+			operr = req.server.serveOperation(opctx, &payload, req.serveWebsocketOperation)
 		}
 
 		if operr != nil && !ContextOperationExecuted(opctx) {
@@ -326,9 +550,9 @@ func (req *websocketRequest) readWebsocketTerminate() (err error) {
 
 	RequestContext(req.ctx).Set(ContextKeyOperationStopped, true)
 
-	req.outgoing <- outgoingMessage{
+	req.send(nil, outgoingMessage{
 		Error: apollows.EventCloseNormal,
-	}
+	})
 
 	return
 }
@@ -367,52 +591,57 @@ func (req *websocketRequest) readWebsocket() {
 		close(req.outgoing)
 	}()
 
-	var connectSuccessful chan struct{}
-
 	if req.server.connectTimeout > 0 {
-		connectSuccessful = make(chan struct{})
+		req.connectSuccessful = make(chan struct{})
 
-		go req.backgroundTimeout(req.server.connectTimeout, connectSuccessful)
+		go req.backgroundTimeout(req.server.connectTimeout, req.connectSuccessful)
 	}
 
 	for {
 		var msg apollows.Message
 
-		err = req.ws.ReadJSON(&msg)
+		err = req.read(&msg)
 		if err != nil {
 			return
 		}
 
-		switch msg.Type {
-		case apollows.OperationConnectionInit:
-			if req.init {
-				err = apollows.EventTooManyInitializationRequests
-
-				return
-			}
+		err = req.readWebsocketMessage(&msg)
+		if err != nil {
+			return
+		}
+	}
+}
 
-			req.init = true
+func (req *websocketRequest) readWebsocketMessage(msg *apollows.Message) (err error) {
+	switch msg.Type {
+	case apollows.OperationConnectionInit:
+		if req.init {
+			return apollows.EventTooManyInitializationRequests
+		}
 
-			if connectSuccessful != nil {
-				connectSuccessful <- struct{}{}
-				close(connectSuccessful)
-			}
+		req.init = true
 
-			err = req.readWebsocketInit(&msg)
-		case apollows.OperationStart, apollows.OperationSubscribe:
-			err = req.readWebsocketStart(&msg)
-		case apollows.OperationStop, apollows.OperationComplete:
-			err = req.readWebsocketStop(&msg)
-		case apollows.OperationTerminate:
-			err = req.readWebsocketTerminate()
-		case apollows.OperationPing:
-			req.readWebsocketPing(&msg)
+		if req.connectSuccessful != nil {
+			req.connectSuccessful <- struct{}{}
+			close(req.connectSuccessful)
 		}
 
-		if err != nil {
-			return
+		if req.connectTimer != nil {
+			req.connectTimer.Stop()
 		}
+
+		err = req.readWebsocketInit(msg)
+	case apollows.OperationStart, apollows.OperationSubscribe:
+		err = req.readWebsocketStart(msg)
+	case apollows.OperationStop, apollows.OperationComplete:
+		err = req.readWebsocketStop(msg)
+	case apollows.OperationTerminate:
+		err = req.readWebsocketTerminate()
+	case apollows.OperationPing:
+		req.readWebsocketPing(msg)
 	}
+
+	return
 }
 
 func (req *websocketRequest) serveWebsocketOperation(
@@ -424,12 +653,18 @@ func (req *websocketRequest) serveWebsocketOperation(
 		return
 	}
 
+	defer req.server.trackSubscription(ctx, payload)()
+
+	if req.server.shared != nil && sharedEligible(ctx) {
+		return req.serveSharedOperation(ctx, payload)
+	}
+
 	cres, err := req.server.interceptors.OperationExecute(ctx, payload, req.server.operationExecute)
 	if err != nil {
 		return
 	}
 
-	return req.server.processResults(ctx, payload, cres, func(ctx context.Context, result *graphql.Result) error {
+	return req.server.processResults(ctx, payload, cres, func(ctx context.Context, result interface{}) error {
 		req.writeWebsocketData(ctx, result)
 
 		return nil
@@ -0,0 +1,144 @@
+package wsgraphql
+
+import (
+	"context"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+)
+
+// detachedContext keeps values of the parent context, but not its cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func contextDetached(ctx context.Context) bool {
+	v, _ := ctx.Value(contextKeyDetached).(bool)
+
+	return v
+}
+
+// serveEventDriven handles connection without dedicated reader and writer goroutines: messages are read once the
+// connection becomes readable, outgoing messages are written by the goroutines producing them
+func (req *websocketRequest) serveEventDriven(conn PollingConn) {
+	reqctx := RequestContext(req.ctx)
+
+	reqctx.Set(contextKeyDetached, true)
+
+	req.polling = conn
+
+	if req.server.connectTimeout > 0 {
+		ctx := req.ctx
+
+		req.connectTimer = time.AfterFunc(req.server.connectTimeout, func() {
+			req.handleError(ctx, apollows.EventInitializationTimeout)
+		})
+	}
+
+	if req.server.keepalive > 0 {
+		req.scheduleKeepalive(reqctx)
+	}
+
+	req.poll(conn)
+}
+
+func (req *websocketRequest) scheduleKeepalive(reqctx context.Context) {
+	time.AfterFunc(req.server.keepalive, func() {
+		if reqctx.Err() != nil {
+			return
+		}
+
+		req.send(nil, req.keepaliveMessage())
+		req.scheduleKeepalive(reqctx)
+	})
+}
+
+func (req *websocketRequest) poll(conn PollingConn) {
+	err := conn.Poll(func() {
+		req.readEvent(conn)
+	})
+	if err != nil {
+		req.finishEventDriven(err)
+	}
+}
+
+// readEvent reads single message once connection is readable, re-arming the poll afterwards
+func (req *websocketRequest) readEvent(conn PollingConn) {
+	var msg apollows.Message
+
+	err := req.deadline(conn.SetReadDeadline)
+	if err == nil {
+		err = req.read(&msg)
+	}
+
+	if err == nil {
+		err = req.readWebsocketMessage(&msg)
+	}
+
+	if err != nil {
+		req.finishEventDriven(err)
+
+		return
+	}
+
+	req.poll(conn)
+}
+
+// writeEvent writes message of event-driven connection, bounded by the write deadline, so writers of the connection
+// are not blocked by slow client indefinitely
+func (req *websocketRequest) writeEvent(msg outgoingMessage) {
+	if req.polling == nil {
+		req.write(msg)
+
+		return
+	}
+
+	err := req.deadline(req.polling.SetWriteDeadline)
+	if err != nil {
+		_ = req.ws.Close(int(apollows.EventCloseNormal), err.Error())
+
+		return
+	}
+
+	req.write(msg)
+}
+
+// deadline sets deadline using provided function, if timeout is configured
+func (req *websocketRequest) deadline(set func(t time.Time) error) error {
+	if req.server.eventTimeout <= 0 {
+		return nil
+	}
+
+	return set(time.Now().Add(req.server.eventTimeout))
+}
+
+func (req *websocketRequest) finishEventDriven(err error) {
+	if err != nil {
+		req.handleError(req.ctx, err)
+	}
+
+	if req.connectTimer != nil {
+		req.connectTimer.Stop()
+	}
+
+	// cancel request context and consequently all pending operation contexts
+	RequestContext(req.ctx).Cancel()
+
+	req.wg.Wait()
+
+	_ = req.ws.Close(int(apollows.EventCloseNormal), "")
+
+	req.observeClosed()
+}
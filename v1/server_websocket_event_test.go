@@ -0,0 +1,282 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPollingWrapper struct {
+	testWrapper
+	polls          *int64
+	writeDeadlines *int64
+}
+
+type testPollingConn struct {
+	testConn
+	polls          *int64
+	writeDeadlines *int64
+}
+
+// SetWriteDeadline implementation, counting deadlines set if requested
+func (conn testPollingConn) SetWriteDeadline(t time.Time) error {
+	if conn.writeDeadlines != nil && !t.IsZero() {
+		atomic.AddInt64(conn.writeDeadlines, 1)
+	}
+
+	return conn.testConn.SetWriteDeadline(t)
+}
+
+// Poll implementation, blocking read in onReadable stands in for readiness notification
+func (conn testPollingConn) Poll(onReadable func()) error {
+	atomic.AddInt64(conn.polls, 1)
+
+	go onReadable()
+
+	return nil
+}
+
+func (g testPollingWrapper) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (Conn, error) {
+	c, err := g.testWrapper.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return testPollingConn{
+		testConn:       c.(testConn),
+		polls:          g.polls,
+		writeDeadlines: g.writeDeadlines,
+	}, nil
+}
+
+func testNewEventDrivenServer(t *testing.T, polls *int64, opts ...ServerOption) *httptest.Server {
+	opts = append(opts, WithEventDriven(), WithUpgrader(testPollingWrapper{
+		testWrapper: testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{
+					apollows.WebsocketSubprotocolGraphqlWS.String(),
+					apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+				},
+			},
+		},
+		polls: polls,
+	}))
+
+	server, err := NewServer(testNewSchema(t), opts...)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func TestNewServerWebsocketEventDriven(t *testing.T) {
+	var polls int64
+
+	srv := testNewEventDrivenServer(t, &polls, WithConnectTimeout(time.Second))
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+	testNewServerWebsocketGWTS(t, srv)
+
+	assert.Greater(t, atomic.LoadInt64(&polls), int64(2))
+}
+
+func TestNewServerWebsocketEventDrivenLifecycle(t *testing.T) {
+	var polls int64
+
+	returned, cancelled := make(chan struct{}), make(chan struct{})
+
+	srv := testNewEventDrivenServer(t, &polls, WithKeepalive(time.Millisecond*10), WithInterceptors(Interceptors{
+		HTTPRequest: func(ctx context.Context, w http.ResponseWriter, r *http.Request, handler HandlerHTTPRequest) error {
+			go func() {
+				<-ctx.Done()
+				close(cancelled)
+			}()
+
+			err := handler(ctx, w, r)
+
+			close(returned)
+
+			return err
+		},
+	}))
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	<-returned
+
+	err = conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationKeepAlive, msg.Type)
+
+	select {
+	case <-cancelled:
+		assert.Fail(t, "request context cancelled while connection is active")
+	default:
+	}
+
+	_ = conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "request context not cancelled after connection is closed")
+	}
+}
+
+func TestNewServerWebsocketEventDrivenTimeout(t *testing.T) {
+	var polls int64
+
+	srv := testNewEventDrivenServer(t, &polls, WithConnectTimeout(time.Millisecond))
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventInitializationTimeout)), "%v", err)
+}
+
+func TestNewServerWebsocketEventDrivenReadTimeout(t *testing.T) {
+	var polls int64
+
+	srv := testNewEventDrivenServer(t, &polls, WithEventDrivenTimeout(time.Millisecond*20))
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	// header of masked text frame, without the mask key and payload
+	_, err = conn.UnderlyingConn().Write([]byte{0x81, 0x85})
+
+	assert.NoError(t, err)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+
+	var neterr net.Error
+
+	if assert.Error(t, err) && errors.As(err, &neterr) {
+		assert.False(t, neterr.Timeout(), "connection not closed on partially received frame")
+	}
+}
+
+func TestNewServerWebsocketEventDrivenWriteDeadline(t *testing.T) {
+	var polls, writeDeadlines int64
+
+	server, err := NewServer(testNewSchema(t), WithEventDriven(), WithUpgrader(testPollingWrapper{
+		testWrapper: testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlWS.String()},
+			},
+		},
+		polls:          &polls,
+		writeDeadlines: &writeDeadlines,
+	}))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+
+	assert.Greater(t, atomic.LoadInt64(&writeDeadlines), int64(2))
+}
+
+func TestNewServerWebsocketEventDrivenRequestCancel(t *testing.T) {
+	cancelled := make(chan struct{})
+
+	server, err := NewServer(testNewSchema(t), WithEventDriven(), WithUpgrader(testWrapper{
+		Upgrader: &websocket.Upgrader{},
+	}), WithInterceptors(Interceptors{
+		HTTPRequest: func(ctx context.Context, w http.ResponseWriter, r *http.Request, handler HandlerHTTPRequest) error {
+			go func() {
+				<-ctx.Done()
+				close(cancelled)
+			}()
+
+			return nil
+		},
+	}))
+
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	req.Header.Set("connection", "upgrade")
+	req.Header.Set("upgrade", "websocket")
+
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	cancel()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "request context not cancelled for connection not handled as event-driven")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/apollows/msgpack"
 	"github.com/eientei/wsgraphql/v1/mutable"
 	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
@@ -595,6 +596,45 @@ func TestNewServerWebsocketProtocolMismatch(t *testing.T) {
 	assert.ErrorContains(t, err, apollows.ErrUnknownProtocol.Error())
 }
 
+func TestNewServerWebsocketCodecMismatch(t *testing.T) {
+	variant := apollows.WebsocketSubprotocolGraphqlTransportWS.Variant(msgpack.Codec{})
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithProtocol(apollows.WebsocketSubprotocolGraphqlTransportWS),
+		WithUpgrader(testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{variant},
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{variant},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.ErrorContains(t, err, apollows.ErrUnknownProtocol.Error())
+}
+
 func TestNewServerWebsocketKeepalive(t *testing.T) {
 	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithKeepalive(time.Millisecond*10))
 
@@ -1331,7 +1371,7 @@ func TestNewServerWebsocketCombineErrorsGWS(t *testing.T) {
 		},
 	}), WithConnectTimeout(time.Second))
 
-	opts = append(opts, WithProtocol(apollows.WebsocketSubprotocolGraphqlWS))
+	opts = append(opts, WithProtocol(apollows.WebsocketSubprotocolGraphqlWS), WithExtensions(ex1, ex2))
 
 	schema, err := graphql.NewSchema(graphql.SchemaConfig{
 		Query: graphql.NewObject(graphql.ObjectConfig{
@@ -1352,10 +1392,6 @@ func TestNewServerWebsocketCombineErrorsGWS(t *testing.T) {
 				},
 			},
 		}),
-		Extensions: []graphql.Extension{
-			ex1,
-			ex2,
-		},
 	})
 
 	assert.NoError(t, err)
@@ -0,0 +1,325 @@
+package wsgraphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/eientei/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+// sharedSubscriberBuffer is the number of events shared execution may queue for a subscriber before dropping it
+const sharedSubscriberBuffer = 16
+
+var errSharedSubscriberOverflow = errors.New("subscriber is too slow to receive shared subscription events")
+
+// sharedSubscriptions deduplicates execution of identical websocket subscriptions, see WithSharedSubscriptions
+type sharedSubscriptions struct {
+	executions map[string]*sharedExecution
+	m          sync.Mutex
+}
+
+type sharedExecution struct {
+	subscribers map[*sharedSubscriber]struct{}
+	ready       chan struct{}
+	ctx         mutable.Context
+	err         error
+	key         string
+	done        bool
+}
+
+type sharedSubscriber struct {
+	exec   *sharedExecution
+	events chan sharedEvent
+	err    error
+}
+
+// sharedEvent carries result payload, encoded once for all subscribers, and error terminating the execution, if any
+type sharedEvent struct {
+	err     error
+	encoded []byte
+}
+
+func newSharedSubscriptions() *sharedSubscriptions {
+	return &sharedSubscriptions{
+		executions: make(map[string]*sharedExecution),
+	}
+}
+
+// sharedKey identifies subscription by its document, operation name and variables, extensions are not considered
+func sharedKey(codec apollows.JSONMarshaler, payload *apollows.PayloadOperation) (string, error) {
+	variables, err := codec.Marshal(payload.Variables)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+
+	_, _ = h.Write([]byte(payload.Query))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(payload.OperationName))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(variables)
+
+	return string(h.Sum(nil)), nil
+}
+
+// sharedEligible returns true if operation may join shared execution
+func sharedEligible(ctx context.Context) bool {
+	return ContextSubscription(ctx) && ContextLastEventID(ctx) == ""
+}
+
+// join subscribes to execution identified by key, starting it in context detached from ctx if there is none yet
+func (shared *sharedSubscriptions) join(
+	ctx context.Context,
+	key string,
+	start func(ctx context.Context) (chan *graphql.Result, error),
+	process func(ctx context.Context, result *graphql.Result) sharedEvent,
+) (*sharedSubscriber, error) {
+	shared.m.Lock()
+
+	exec, ok := shared.executions[key]
+	if !ok {
+		exec = &sharedExecution{
+			subscribers: make(map[*sharedSubscriber]struct{}),
+			ready:       make(chan struct{}),
+			ctx:         mutable.NewMutableContext(detachedContext{ctx}),
+			key:         key,
+		}
+
+		exec.ctx.Set(ContextKeyOperationContext, exec.ctx)
+		exec.ctx.Set(contextKeyEventCursor, &eventCursor{})
+
+		shared.executions[key] = exec
+	}
+
+	sub := &sharedSubscriber{
+		exec:   exec,
+		events: make(chan sharedEvent, sharedSubscriberBuffer),
+	}
+
+	exec.subscribers[sub] = struct{}{}
+
+	shared.m.Unlock()
+
+	if !ok {
+		cres, err := shared.start(exec, start)
+		if err != nil {
+			exec.err = err
+
+			shared.finish(exec)
+		} else {
+			go shared.serve(exec, cres, process)
+		}
+
+		close(exec.ready)
+	}
+
+	select {
+	case <-exec.ready:
+	case <-ctx.Done():
+		shared.leave(sub)
+
+		return nil, ctx.Err()
+	}
+
+	if exec.err != nil {
+		shared.leave(sub)
+
+		return nil, exec.err
+	}
+
+	return sub, nil
+}
+
+// start starts the execution, reporting panic as an error, so subscribers waiting for it are released
+func (shared *sharedSubscriptions) start(
+	exec *sharedExecution,
+	start func(ctx context.Context) (chan *graphql.Result, error),
+) (cres chan *graphql.Result, err error) {
+	defer recoverPanic(exec.ctx, &err)
+
+	return start(exec.ctx)
+}
+
+// serve delivers results to subscribers until execution is over or there are no subscribers left, panic not
+// recovered by process is delivered to all subscribers as an error
+func (shared *sharedSubscriptions) serve(
+	exec *sharedExecution,
+	cres chan *graphql.Result,
+	process func(ctx context.Context, result *graphql.Result) sharedEvent,
+) {
+	defer shared.finish(exec)
+
+	defer func() {
+		if r := recover(); r != nil {
+			shared.broadcast(exec, sharedEvent{
+				err: handlePanic(exec.ctx, r),
+			})
+		}
+	}()
+
+	for {
+		var (
+			result *graphql.Result
+			ok     bool
+		)
+
+		select {
+		case result, ok = <-cres:
+		case <-exec.ctx.Done():
+		}
+
+		if !ok {
+			return
+		}
+
+		ev := process(exec.ctx, result)
+
+		shared.broadcast(exec, ev)
+
+		if ev.err != nil {
+			return
+		}
+	}
+}
+
+// broadcast queues event to every subscriber, dropping subscribers whose queue is full, so a single slow
+// subscriber does not delay others
+func (shared *sharedSubscriptions) broadcast(exec *sharedExecution, ev sharedEvent) {
+	shared.m.Lock()
+	defer shared.m.Unlock()
+
+	for sub := range exec.subscribers {
+		select {
+		case sub.events <- ev:
+		default:
+			delete(exec.subscribers, sub)
+
+			sub.err = errSharedSubscriberOverflow
+
+			close(sub.events)
+		}
+	}
+}
+
+// leave unsubscribes from the execution, cancelling it once last subscriber leaves
+func (shared *sharedSubscriptions) leave(sub *sharedSubscriber) {
+	shared.m.Lock()
+	defer shared.m.Unlock()
+
+	exec := sub.exec
+
+	delete(exec.subscribers, sub)
+
+	if len(exec.subscribers) > 0 || exec.done {
+		return
+	}
+
+	exec.done = true
+
+	if shared.executions[exec.key] == exec {
+		delete(shared.executions, exec.key)
+	}
+
+	exec.ctx.Cancel()
+}
+
+// finish closes event channels of remaining subscribers, subsequent subscribers start new execution
+func (shared *sharedSubscriptions) finish(exec *sharedExecution) {
+	shared.m.Lock()
+	defer shared.m.Unlock()
+
+	for sub := range exec.subscribers {
+		close(sub.events)
+	}
+
+	exec.subscribers = nil
+	exec.done = true
+
+	if shared.executions[exec.key] == exec {
+		delete(shared.executions, exec.key)
+	}
+
+	exec.ctx.Cancel()
+}
+
+// processSharedResult processes result once for all subscribers of shared execution, panic is delivered as an
+// error result
+func (server *serverImpl) processSharedResult(
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	result *graphql.Result,
+) (ev sharedEvent) {
+	write := func(ctx context.Context, result interface{}) (err error) {
+		ev.encoded, err = server.jsonCodec.Marshal(result)
+
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ev.err = server.processPanic(ctx, r, write)
+		}
+	}()
+
+	ev.err = server.processResult(ctx, payload, result, write)
+
+	return
+}
+
+// serveSharedOperation joins shared execution of identical subscription, writing its pre-encoded results
+func (req *websocketRequest) serveSharedOperation(ctx context.Context, payload *apollows.PayloadOperation) error {
+	key, err := sharedKey(req.server.jsonCodec, payload)
+	if err != nil {
+		return err
+	}
+
+	server := req.server
+
+	key = schemaSharedKey(server.operationSchemaState(ctx), key)
+
+	sub, err := server.shared.join(
+		ctx,
+		key,
+		func(ctx context.Context) (chan *graphql.Result, error) {
+			return server.interceptors.OperationExecute(ctx, payload, server.operationExecute)
+		},
+		func(ctx context.Context, result *graphql.Result) sharedEvent {
+			return server.processSharedResult(ctx, payload, result)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	defer server.shared.leave(sub)
+
+	OperationContext(ctx).Set(ContextKeyOperationExecuted, true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if !ContextOperationStopped(ctx) {
+				return ctx.Err()
+			}
+
+			return nil
+		case ev, ok := <-sub.events:
+			if !ok {
+				return sub.err
+			}
+
+			if ev.encoded != nil {
+				req.writeWebsocketEncoded(ctx, ev.encoded)
+			}
+
+			if ev.err != nil {
+				return ev.err
+			}
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSharedTopics struct {
+	channels   map[string][]chan interface{}
+	subscribes int64
+	resolves   int64
+	m          sync.Mutex
+}
+
+func (topics *testSharedTopics) publish(name string, value interface{}) {
+	topics.m.Lock()
+	defer topics.m.Unlock()
+
+	for _, ch := range topics.channels[name] {
+		ch <- value
+	}
+}
+
+func (topics *testSharedTopics) schema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"topic": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"name": &graphql.ArgumentConfig{
+							Type: graphql.String,
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						atomic.AddInt64(&topics.resolves, 1)
+
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						atomic.AddInt64(&topics.subscribes, 1)
+
+						name, _ := p.Args["name"].(string)
+						ch := make(chan interface{}, 1)
+
+						topics.m.Lock()
+						topics.channels[name] = append(topics.channels[name], ch)
+						topics.m.Unlock()
+
+						go func() {
+							<-p.Context.Done()
+
+							topics.m.Lock()
+							defer topics.m.Unlock()
+
+							chans := topics.channels[name]
+
+							for i, c := range chans {
+								if c == ch {
+									topics.channels[name] = append(chans[:i], chans[i+1:]...)
+
+									break
+								}
+							}
+						}()
+
+						return ch, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func testSharedServer(t *testing.T, topics *testSharedTopics) (*serverImpl, *httptest.Server) {
+	server, err := NewServer(
+		topics.schema(t),
+		WithSharedSubscriptions(),
+		WithUpgrader(testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{
+					apollows.WebsocketSubprotocolGraphqlWS.String(),
+					apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+				},
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	return server.(*serverImpl), httptest.NewServer(server)
+}
+
+func testSharedSubscribe(
+	t *testing.T,
+	srv *httptest.Server,
+	protocol apollows.Protocol,
+	name string,
+) *websocket.Conn {
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{protocol.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	start := apollows.OperationStart
+
+	if protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
+		start = apollows.OperationSubscribe
+	}
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: start,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription ($name: String) { topic(name: $name) }`,
+				Variables: map[string]interface{}{
+					"name": name,
+				},
+			},
+		},
+	}))
+
+	return conn
+}
+
+func testSharedSubscribers(server *serverImpl) (res int) {
+	server.shared.m.Lock()
+	defer server.shared.m.Unlock()
+
+	for _, exec := range server.shared.executions {
+		res += len(exec.subscribers)
+	}
+
+	return
+}
+
+func TestSharedSubscriptions(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	server, srv := testSharedServer(t, topics)
+
+	defer srv.Close()
+
+	conns := []*websocket.Conn{
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlWS, "foo"),
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo"),
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo"),
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "bar"),
+	}
+
+	assert.Eventually(t, func() bool {
+		topics.m.Lock()
+		defer topics.m.Unlock()
+
+		return testSharedSubscribers(server) == len(conns) && len(topics.channels) == 2
+	}, time.Second, time.Millisecond)
+
+	assert.EqualValues(t, 2, atomic.LoadInt64(&topics.subscribes))
+	assert.Len(t, server.shared.executions, 2)
+
+	topics.publish("foo", 1)
+	topics.publish("foo", 2)
+	topics.publish("bar", 3)
+
+	for i, conn := range conns[:3] {
+		for _, v := range []int{1, 2} {
+			var msg apollows.Message
+
+			assert.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, "1", msg.ID)
+
+			if i == 0 {
+				assert.Equal(t, apollows.OperationData, msg.Type)
+			} else {
+				assert.Equal(t, apollows.OperationNext, msg.Type)
+			}
+
+			pd, err := msg.Payload.ReadPayloadData()
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, v, pd.Data["topic"])
+		}
+	}
+
+	var msg apollows.Message
+
+	assert.NoError(t, conns[3].ReadJSON(&msg))
+
+	pd, err := msg.Payload.ReadPayloadData()
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, pd.Data["topic"])
+
+	assert.EqualValues(t, 3, atomic.LoadInt64(&topics.resolves))
+
+	assert.NoError(t, conns[1].WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationComplete,
+	}))
+
+	assert.Eventually(t, func() bool {
+		return testSharedSubscribers(server) == len(conns)-1
+	}, time.Second, time.Millisecond)
+
+	for _, conn := range conns {
+		assert.NoError(t, conn.Close())
+	}
+
+	assert.Eventually(t, func() bool {
+		topics.m.Lock()
+		defer topics.m.Unlock()
+
+		return len(topics.channels["foo"]) == 0 && len(topics.channels["bar"]) == 0
+	}, time.Second, time.Millisecond)
+
+	server.shared.m.Lock()
+	assert.Len(t, server.shared.executions, 0)
+	server.shared.m.Unlock()
+}
+
+func TestSharedSubscriptionsLeave(t *testing.T) {
+	shared := newSharedSubscriptions()
+
+	var starts int64
+
+	start := func(ctx context.Context) (chan *graphql.Result, error) {
+		atomic.AddInt64(&starts, 1)
+
+		cres := make(chan *graphql.Result)
+
+		go func() {
+			<-ctx.Done()
+			close(cres)
+		}()
+
+		return cres, nil
+	}
+
+	process := func(ctx context.Context, result *graphql.Result) sharedEvent {
+		return sharedEvent{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	first, err := shared.join(ctx, "key", start, process)
+
+	assert.NoError(t, err)
+
+	second, err := shared.join(ctx, "key", start, process)
+
+	assert.NoError(t, err)
+	assert.Equal(t, first.exec, second.exec)
+
+	shared.leave(first)
+
+	assert.NoError(t, first.exec.ctx.Err())
+
+	shared.leave(second)
+
+	assert.Error(t, second.exec.ctx.Err())
+
+	third, err := shared.join(ctx, "key", start, process)
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.exec, third.exec)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&starts))
+
+	shared.leave(third)
+}
+
+func TestSharedSubscriptionsOverflow(t *testing.T) {
+	shared := newSharedSubscriptions()
+
+	cres := make(chan *graphql.Result)
+
+	start := func(ctx context.Context) (chan *graphql.Result, error) {
+		return cres, nil
+	}
+
+	process := func(ctx context.Context, result *graphql.Result) sharedEvent {
+		return sharedEvent{
+			encoded: []byte("{}"),
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	fast, err := shared.join(ctx, "key", start, process)
+
+	assert.NoError(t, err)
+
+	slow, err := shared.join(ctx, "key", start, process)
+
+	assert.NoError(t, err)
+
+	for i := 0; i < sharedSubscriberBuffer+1; i++ {
+		cres <- &graphql.Result{}
+
+		_, ok := <-fast.events
+
+		assert.True(t, ok)
+	}
+
+	for i := 0; i < sharedSubscriberBuffer; i++ {
+		_, ok := <-slow.events
+
+		assert.True(t, ok)
+	}
+
+	_, ok := <-slow.events
+
+	assert.False(t, ok)
+	assert.Equal(t, errSharedSubscriberOverflow, slow.err)
+
+	shared.leave(slow)
+
+	assert.NoError(t, fast.exec.ctx.Err())
+
+	shared.leave(fast)
+
+	assert.Error(t, fast.exec.ctx.Err())
+}
+
+func TestSharedSubscriptionsDisabled(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	server, err := NewServer(
+		topics.schema(t),
+		WithSharedSubscriptions(),
+		WithRootObjectProvider(func(ctx context.Context, payload *apollows.PayloadOperation) map[string]interface{} {
+			return nil
+		}),
+	)
+
+	assert.NoError(t, err)
+	assert.Nil(t, server.(*serverImpl).shared)
+}
+
+func TestSharedSubscriptionsPanic(t *testing.T) {
+	topics := &testSharedTopics{
+		channels: make(map[string][]chan interface{}),
+	}
+
+	var recovered int64
+
+	server, err := NewServer(
+		topics.schema(t),
+		WithSharedSubscriptions(),
+		WithResultProcessor(func(
+			ctx context.Context,
+			payload *apollows.PayloadOperation,
+			result *graphql.Result,
+		) *graphql.Result {
+			panic("result panic")
+		}),
+		WithPanicHandler(func(ctx context.Context, err *PanicError) error {
+			atomic.AddInt64(&recovered, 1)
+
+			return errors.New("recovered")
+		}),
+		WithUpgrader(testWrapper{
+			Upgrader: &websocket.Upgrader{
+				Subprotocols: []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	impl := server.(*serverImpl)
+
+	conns := []*websocket.Conn{
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo"),
+		testSharedSubscribe(t, srv, apollows.WebsocketSubprotocolGraphqlTransportWS, "foo"),
+	}
+
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		return testSharedSubscribers(impl) == len(conns)
+	}, time.Second, time.Millisecond)
+
+	topics.publish("foo", 1)
+
+	for _, conn := range conns {
+		var msg apollows.Message
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, "1", msg.ID)
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		pd, err := msg.Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+
+		if assert.Len(t, pd.Errors, 1) {
+			assert.Equal(t, "recovered", pd.Errors[0].Message)
+		}
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationComplete, msg.Type)
+	}
+
+	assert.EqualValues(t, 1, atomic.LoadInt64(&recovered))
+
+	assert.Eventually(t, func() bool {
+		impl.shared.m.Lock()
+		defer impl.shared.m.Unlock()
+
+		return len(impl.shared.executions) == 0
+	}, time.Second, time.Millisecond)
+
+	// connections are not affected by the panic
+	for _, conn := range conns {
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			ID:   "2",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `query { getFoo }`,
+				},
+			},
+		}))
+
+		var msg apollows.Message
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, "2", msg.ID)
+	}
+}
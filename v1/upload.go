@@ -0,0 +1,376 @@
+package wsgraphql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+var (
+	errUploadsRejected = errors.New("multipart uploads are not enabled")
+	errUploadMalformed = errors.New("malformed multipart upload request")
+	errUploadTooLarge  = errors.New("uploaded file is too large")
+
+	errUploadFormTooLarge = errors.New("multipart form values are too large")
+)
+
+// UploadScalar Upload scalar type definition, to be used as type of arguments accepting files sent in multipart
+// requests, as defined by https://github.com/jaydenseric/graphql-multipart-request-spec
+// Resolvers receive *Upload values.
+var UploadScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Upload",
+	Description: "The `Upload` scalar type represents a file upload.",
+	Serialize: func(value interface{}) interface{} {
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		upload, ok := value.(*Upload)
+		if !ok {
+			return nil
+		}
+
+		return upload
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+// Upload provides access to file received in multipart request. Files are available until the request is finished,
+// after which any files opened with Open are closed and temporary storage is removed.
+type Upload struct {
+	form        *uploadForm
+	content     []byte
+	tmpfile     string
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+// Open opens uploaded file for reading
+func (upload *Upload) Open() (multipart.File, error) {
+	if upload.tmpfile == "" {
+		return uploadContent{
+			SectionReader: io.NewSectionReader(bytes.NewReader(upload.content), 0, int64(len(upload.content))),
+		}, nil
+	}
+
+	f, err := os.Open(upload.tmpfile)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.form.m.Lock()
+	upload.form.opened = append(upload.form.opened, f)
+	upload.form.m.Unlock()
+
+	return f, nil
+}
+
+// uploadContent is multipart.File of upload kept in memory
+type uploadContent struct {
+	*io.SectionReader
+}
+
+func (uploadContent) Close() error {
+	return nil
+}
+
+// WithUploads option enables multipart file uploads in HTTP requests, keeping up to maxMemory bytes of files in
+// memory (rest is stored in temporary files), rejecting files larger than maxFileSize and requests larger than
+// maxRequestSize. Zero values disable corresponding limits. Limits are enforced while the request is received, files
+// must follow "operations" and "map" fields, as required by the spec, files not referenced by the map are skipped.
+func WithUploads(maxMemory, maxFileSize, maxRequestSize int64) ServerOption {
+	return func(config *serverConfig) error {
+		config.uploads = true
+		config.uploadMaxMemory = maxMemory
+		config.uploadMaxFileSize = maxFileSize
+		config.uploadMaxRequestSize = maxRequestSize
+
+		return nil
+	}
+}
+
+type uploadForm struct {
+	files      map[string]*Upload
+	mapping    map[string][]string
+	operations []byte
+	opened     []multipart.File
+	m          sync.Mutex
+}
+
+func isMultipartForm(r *http.Request) bool {
+	mediatype, _, err := mime.ParseMediaType(r.Header.Get("content-type"))
+
+	return err == nil && mediatype == "multipart/form-data"
+}
+
+func (server *serverImpl) readUploadForm(ctx context.Context, r *http.Request) (res *uploadForm, err error) {
+	if !server.uploads {
+		return nil, errUploadsRejected
+	}
+
+	if server.uploadMaxRequestSize > 0 {
+		r.Body = http.MaxBytesReader(ContextHTTPResponseWriter(ctx), r.Body, server.uploadMaxRequestSize)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	maxMemory := server.uploadMaxMemory
+	if maxMemory <= 0 {
+		maxMemory = 32 << 20
+	}
+
+	// as with multipart.Reader.ReadForm, non-file values are limited separately
+	maxValues := int64(10 << 20)
+
+	res = &uploadForm{
+		files: make(map[string]*Upload),
+	}
+
+	defer func() {
+		if err != nil {
+			res.cleanup()
+			res = nil
+		}
+	}()
+
+	// parts are read as they arrive, so limits are enforced before the rest of the request is received
+	for {
+		var part *multipart.Part
+
+		part, err = reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return res, err
+		}
+
+		err = server.readUploadPart(res, part, &maxMemory, &maxValues)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if res.operations == nil || res.mapping == nil {
+		return res, errUploadMalformed
+	}
+
+	for key := range res.mapping {
+		if res.files[key] == nil {
+			return res, errUploadMalformed
+		}
+	}
+
+	return res, nil
+}
+
+// readUploadPart reads operations, map or file part, as defined by multipart request spec, files must follow map
+func (server *serverImpl) readUploadPart(
+	form *uploadForm,
+	part *multipart.Part,
+	maxMemory, maxValues *int64,
+) (err error) {
+	// part is not closed, since closing drains it, NextPart skips unread content instead
+	name := part.FormName()
+
+	if part.FileName() == "" {
+		bs, err := io.ReadAll(io.LimitReader(part, *maxValues+1))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(bs)) > *maxValues {
+			return errUploadFormTooLarge
+		}
+
+		*maxValues -= int64(len(bs))
+
+		switch {
+		case name == "operations" && form.operations == nil:
+			form.operations = bs
+		case name == "map" && form.mapping == nil:
+			err = server.jsonCodec.Unmarshal(bs, &form.mapping)
+			if err != nil || form.mapping == nil {
+				return errUploadMalformed
+			}
+		default:
+			return errUploadMalformed
+		}
+
+		return nil
+	}
+
+	if form.mapping == nil {
+		return errUploadMalformed
+	}
+
+	// files not referenced by the map are not stored
+	if _, ok := form.mapping[name]; !ok {
+		return nil
+	}
+
+	if form.files[name] != nil {
+		return errUploadMalformed
+	}
+
+	upload := &Upload{
+		form:        form,
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("content-type"),
+	}
+
+	form.files[name] = upload
+
+	var r io.Reader = part
+
+	if server.uploadMaxFileSize > 0 {
+		r = io.LimitReader(part, server.uploadMaxFileSize+1)
+	}
+
+	var buf bytes.Buffer
+
+	upload.Size, err = io.CopyN(&buf, r, *maxMemory+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if upload.Size <= *maxMemory {
+		upload.content = buf.Bytes()
+
+		*maxMemory -= upload.Size
+	} else {
+		upload.Size, err = upload.spill(io.MultiReader(&buf, r))
+		if err != nil {
+			return err
+		}
+	}
+
+	if server.uploadMaxFileSize > 0 && upload.Size > server.uploadMaxFileSize {
+		return errUploadTooLarge
+	}
+
+	return nil
+}
+
+// spill stores file exceeding memory limit in temporary file
+func (upload *Upload) spill(r io.Reader) (n int64, err error) {
+	f, err := os.CreateTemp("", "wsgraphql-upload-")
+	if err != nil {
+		return 0, err
+	}
+
+	upload.tmpfile = f.Name()
+
+	n, err = io.Copy(f, r)
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	return n, err
+}
+
+// inject replaces variables referenced in the map with uploads, prefix is batch index or empty string
+func (form *uploadForm) inject(payload *apollows.PayloadOperation, prefix string) error {
+	if form == nil {
+		return nil
+	}
+
+	for key, paths := range form.mapping {
+		upload := form.files[key]
+
+		for _, path := range paths {
+			parts := strings.Split(path, ".")
+
+			if prefix != "" {
+				if parts[0] != prefix {
+					continue
+				}
+
+				parts = parts[1:]
+			}
+
+			if len(parts) < 2 || parts[0] != "variables" || payload.Variables == nil {
+				return errUploadMalformed
+			}
+
+			err := uploadSet(payload.Variables, parts[1:], upload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func uploadSet(target interface{}, parts []string, upload *Upload) error {
+	last := len(parts) == 1
+
+	switch v := target.(type) {
+	case map[string]interface{}:
+		if last {
+			v[parts[0]] = upload
+
+			return nil
+		}
+
+		return uploadSet(v[parts[0]], parts[1:], upload)
+	case []interface{}:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 || idx >= len(v) {
+			return errUploadMalformed
+		}
+
+		if last {
+			v[idx] = upload
+
+			return nil
+		}
+
+		return uploadSet(v[idx], parts[1:], upload)
+	}
+
+	return errUploadMalformed
+}
+
+func (form *uploadForm) cleanup() {
+	if form == nil {
+		return
+	}
+
+	form.m.Lock()
+
+	for _, f := range form.opened {
+		_ = f.Close()
+	}
+
+	form.opened = nil
+
+	form.m.Unlock()
+
+	for _, upload := range form.files {
+		if upload.tmpfile != "" {
+			_ = os.Remove(upload.tmpfile)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package wsgraphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eientei/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewUploadServer(t *testing.T, uploads *[]*Upload, opts ...ServerOption) *httptest.Server {
+	var m sync.Mutex
+
+	read := func(upload *Upload) (interface{}, error) {
+		m.Lock()
+		*uploads = append(*uploads, upload)
+		m.Unlock()
+
+		f, err := upload.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		bs, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return upload.Filename + ":" + string(bs), nil
+	}
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "MutationRoot",
+			Fields: graphql.Fields{
+				"upload": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{
+						"file": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(UploadScalar),
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						upload, _ := p.Args["file"].(*Upload)
+
+						return read(upload)
+					},
+				},
+				"uploads": &graphql.Field{
+					Type: graphql.NewList(graphql.String),
+					Args: graphql.FieldConfigArgument{
+						"files": &graphql.ArgumentConfig{
+							Type: graphql.NewList(UploadScalar),
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						files, _ := p.Args["files"].([]interface{})
+
+						var res []interface{}
+
+						for _, f := range files {
+							upload, _ := f.(*Upload)
+
+							v, err := read(upload)
+							if err != nil {
+								return nil, err
+							}
+
+							res = append(res, v)
+						}
+
+						return res, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	server, err := NewServer(schema, opts...)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func testUploadRequest(
+	t *testing.T,
+	srv *httptest.Server,
+	operations interface{},
+	mapping map[string][]string,
+	files map[string]string,
+) *http.Response {
+	var buf bytes.Buffer
+
+	mw := multipart.NewWriter(&buf)
+
+	bs, err := json.Marshal(operations)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mw.WriteField("operations", string(bs)))
+
+	bs, err = json.Marshal(mapping)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mw.WriteField("map", string(bs)))
+
+	for key, content := range files {
+		w, err := mw.CreateFormFile(key, key+".txt")
+
+		assert.NoError(t, err)
+
+		_, err = w.Write([]byte(content))
+
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, mw.Close())
+
+	resp, err := srv.Client().Post(srv.URL, mw.FormDataContentType(), &buf)
+
+	assert.NoError(t, err)
+
+	return resp
+}
+
+func TestUploads(t *testing.T) {
+	var uploads []*Upload
+
+	srv := testNewUploadServer(t, &uploads, WithUploads(1, 0, 0), WithBatching(0, 0))
+
+	defer srv.Close()
+
+	resp := testUploadRequest(t, srv, apollows.PayloadOperation{
+		Query: `mutation ($file: Upload!, $files: [Upload]) { upload(file: $file) uploads(files: $files) }`,
+		Variables: map[string]interface{}{
+			"file":  nil,
+			"files": []interface{}{nil, nil},
+		},
+	}, map[string][]string{
+		"0": {"variables.file"},
+		"1": {"variables.files.0"},
+		"2": {"variables.files.1"},
+	}, map[string]string{
+		"0": "foo",
+		"1": "bar",
+		"2": "baz",
+	})
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Empty(t, pd.Errors)
+	assert.Equal(t, "0.txt:foo", pd.Data["upload"])
+	assert.Equal(t, []interface{}{"1.txt:bar", "2.txt:baz"}, pd.Data["uploads"])
+
+	assert.Len(t, uploads, 3)
+
+	// temporary storage is removed once request is complete
+	_, err := uploads[0].Open()
+
+	assert.Error(t, err)
+
+	resp = testUploadRequest(t, srv, []apollows.PayloadOperation{
+		{
+			Query: `mutation ($file: Upload!) { upload(file: $file) }`,
+			Variables: map[string]interface{}{
+				"file": nil,
+			},
+		},
+		{
+			Query: `mutation ($file: Upload!) { upload(file: $file) }`,
+			Variables: map[string]interface{}{
+				"file": nil,
+			},
+		},
+	}, map[string][]string{
+		"0": {"0.variables.file", "1.variables.file"},
+	}, map[string]string{
+		"0": "foo",
+	})
+
+	var pds []apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pds))
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Len(t, pds, 2)
+
+	for _, pd := range pds {
+		assert.Empty(t, pd.Errors)
+		assert.Equal(t, "0.txt:foo", pd.Data["upload"])
+	}
+}
+
+func TestUploadsLimits(t *testing.T) {
+	var uploads []*Upload
+
+	srv := testNewUploadServer(t, &uploads, WithUploads(0, 2, 0))
+
+	defer srv.Close()
+
+	resp := testUploadRequest(t, srv, apollows.PayloadOperation{
+		Query: `mutation ($file: Upload!) { upload(file: $file) }`,
+		Variables: map[string]interface{}{
+			"file": nil,
+		},
+	}, map[string][]string{
+		"0": {"variables.file"},
+	}, map[string]string{
+		"0": "foo",
+	})
+
+	var pd apollows.PayloadDataResponse
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errUploadTooLarge.Error(), pd.Errors[0].Message)
+
+	resp = testUploadRequest(t, srv, apollows.PayloadOperation{
+		Query: `mutation ($file: Upload!) { upload(file: $file) }`,
+	}, map[string][]string{
+		"0": {"foo.file"},
+	}, map[string]string{
+		"0": "f",
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errUploadMalformed.Error(), pd.Errors[0].Message)
+}
+
+func TestUploadsRejected(t *testing.T) {
+	var uploads []*Upload
+
+	srv := testNewUploadServer(t, &uploads)
+
+	defer srv.Close()
+
+	resp := testUploadRequest(t, srv, apollows.PayloadOperation{
+		Query: `mutation ($file: Upload!) { upload(file: $file) }`,
+	}, map[string][]string{
+		"0": {"variables.file"},
+	}, map[string]string{
+		"0": "foo",
+	})
+
+	var pd apollows.PayloadDataResponse
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errUploadsRejected.Error(), pd.Errors[0].Message)
+	assert.Empty(t, uploads)
+}
+
+func TestUploadsLimitsStreaming(t *testing.T) {
+	var uploads []*Upload
+
+	srv := testNewUploadServer(t, &uploads, WithUploads(1, 2, 0))
+
+	defer srv.Close()
+
+	const size = 64 << 20
+
+	pr, pw := io.Pipe()
+
+	mw := multipart.NewWriter(pw)
+
+	var written int64
+
+	go func() {
+		_ = mw.WriteField("operations", `{"query":"mutation ($file: Upload!) { upload(file: $file) }"}`)
+		_ = mw.WriteField("map", `{"0":["variables.file"]}`)
+
+		w, _ := mw.CreateFormFile("0", "0.txt")
+
+		chunk := make([]byte, 32<<10)
+
+		for atomic.LoadInt64(&written) < size {
+			n, err := w.Write(chunk)
+			if err != nil {
+				return
+			}
+
+			atomic.AddInt64(&written, int64(n))
+		}
+
+		_ = mw.Close()
+		_ = pw.Close()
+	}()
+
+	resp, err := srv.Client().Post(srv.URL, mw.FormDataContentType(), pr)
+
+	assert.NoError(t, err)
+
+	// request is rejected as soon as the limit is exceeded, without reading the rest of the file
+	assert.Less(t, atomic.LoadInt64(&written), int64(size))
+
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, errUploadTooLarge.Error(), pd.Errors[0].Message)
+	assert.Empty(t, uploads)
+}